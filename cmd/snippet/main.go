@@ -0,0 +1,259 @@
+// Command snippet is a command-line client for snippetbox. It talks to the
+// server over the JSON API, using the server address and API token saved
+// by "snippet configure".
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"thienel/lets-go/internal/client"
+	"thienel/lets-go/internal/models"
+)
+
+const usage = `Usage: snippet [-config file] <command> [flags] [args]
+
+Commands:
+  configure -url URL -token TOKEN   save the server address and API token
+  create [flags] < file             create a snippet from standard input
+  get <slug>                        print a snippet's content
+  list [-after cursor] [-limit n]   list the newest public snippets
+  search [-page n] <query>          search public snippets
+
+Run "snippet <command> -h" for a command's flags.
+`
+
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	if err != nil {
+		if !errors.Is(err, errUsage) && !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "snippet:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("snippet", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { fmt.Fprint(stderr, usage) }
+
+	defaultPath, _ := client.DefaultConfigPath()
+	configPath := fs.String("config", defaultPath, "Path of the config file")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	cfg, err := client.LoadConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("reading config: %w", err)
+	}
+
+	cmd := &command{
+		cfg:        cfg,
+		configPath: *configPath,
+		client:     client.New(cfg.URL, cfg.Token),
+		stdin:      stdin,
+		stdout:     stdout,
+		stderr:     stderr,
+	}
+
+	name, args := fs.Arg(0), fs.Args()[1:]
+	switch name {
+	case "configure":
+		return cmd.configure(args)
+	case "create":
+		return cmd.create(args)
+	case "get":
+		return cmd.get(args)
+	case "list":
+		return cmd.list(args)
+	case "search":
+		return cmd.search(args)
+	default:
+		fmt.Fprintf(stderr, "snippet: unknown command %q\n\n", name)
+		fs.Usage()
+		return errUsage
+	}
+}
+
+type command struct {
+	cfg        *client.Config
+	configPath string
+	client     *client.Client
+	stdin      io.Reader
+	stdout     io.Writer
+	stderr     io.Writer
+}
+
+func (c *command) flagSet(name, argsUsage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(c.stderr, "Usage: snippet %s [flags] %s\n", name, argsUsage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func (c *command) configure(args []string) error {
+	fs := c.flagSet("configure", "")
+	url := fs.String("url", c.cfg.URL, "Address of the snippetbox server")
+	token := fs.String("token", c.cfg.Token,
+		"Personal API token, from your account page")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	c.cfg.URL = strings.TrimRight(*url, "/")
+	c.cfg.Token = *token
+
+	err = c.cfg.Save(c.configPath)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.stdout, "Saved configuration to %s\n", c.configPath)
+	return nil
+}
+
+func (c *command) create(args []string) error {
+	fs := c.flagSet("create", "< file")
+	in := &models.SnippetInput{}
+	fs.StringVar(&in.Title, "title", "Untitled", "Title of the snippet")
+	fs.StringVar(&in.Language, "lang", "", "Language for syntax highlighting")
+	fs.StringVar(&in.Visibility, "visibility", models.VisibilityPublic,
+		"public, unlisted or private")
+	fs.StringVar(&in.Expires, "expires", "365d", "10m, 1h, 1d, 7d, 365d or never")
+	fs.BoolVar(&in.BurnAfterReading, "burn", false,
+		"Delete the snippet after its first view")
+	fs.StringVar(&in.Password, "password", "", "Password needed to read the snippet")
+	tags := fs.String("tags", "", "Comma-separated tags")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	content, err := io.ReadAll(c.stdin)
+	if err != nil {
+		return err
+	}
+	in.Content = string(content)
+
+	if *tags != "" {
+		in.Tags = strings.Split(*tags, ",")
+	}
+
+	snippet, err := c.client.Create(in)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(c.stdout, c.client.SnippetURL(snippet.Slug))
+	return nil
+}
+
+func (c *command) get(args []string) error {
+	fs := c.flagSet("get", "<slug>")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+
+	snippet, err := c.client.Get(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprint(c.stdout, snippet.Content)
+	if !strings.HasSuffix(snippet.Content, "\n") {
+		fmt.Fprintln(c.stdout)
+	}
+	return nil
+}
+
+func (c *command) list(args []string) error {
+	fs := c.flagSet("list", "")
+	after := fs.String("after", "", "Cursor printed by a previous page")
+	limit := fs.Int("limit", 0, "Number of snippets to list, up to 100")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	list, err := c.client.List(*after, *limit)
+	if err != nil {
+		return err
+	}
+
+	c.printSnippets(list.Snippets)
+	if list.Next != "" {
+		fmt.Fprintf(c.stderr, "More: snippet list -after %s\n", list.Next)
+	}
+	return nil
+}
+
+func (c *command) search(args []string) error {
+	fs := c.flagSet("search", "<query>")
+	page := fs.Int("page", 1, "Page of results to show")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	query := strings.Join(fs.Args(), " ")
+
+	results, err := c.client.Search(query, *page)
+	if err != nil {
+		return err
+	}
+
+	if len(results.Snippets) == 0 {
+		fmt.Fprintln(c.stderr, "No snippets found")
+		return nil
+	}
+
+	c.printSnippets(results.Snippets)
+	if results.NextPage != 0 {
+		fmt.Fprintf(c.stderr, "More: snippet search -page %d %s\n",
+			results.NextPage, query)
+	}
+	return nil
+}
+
+func (c *command) printSnippets(snippets []*models.Snippet) {
+	tw := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SLUG\tTITLE\tAUTHOR\tCREATED")
+	for _, s := range snippets {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", s.Slug, s.Title, s.UserName,
+			s.Created.Local().Format("02 Jan 2006 15:04"))
+	}
+	tw.Flush()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"thienel/lets-go/internal/assert"
+	"thienel/lets-go/internal/client"
+)
+
+func TestRunConfigure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+
+	var stdout, stderr bytes.Buffer
+	err := run([]string{"-config", path, "configure", "-url",
+		"https://snippets.example.com/", "-token", "sb_c2VjcmV0"},
+		strings.NewReader(""), &stdout, &stderr)
+	assert.NilErr(t, err)
+	assert.StringContains(t, stdout.String(), "Saved configuration to "+path)
+
+	cfg, err := client.LoadConfig(path)
+	assert.NilErr(t, err)
+	assert.Equal(t, cfg.URL, "https://snippets.example.com")
+	assert.Equal(t, cfg.Token, "sb_c2VjcmV0")
+}
+
+func TestRunUsage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantStderr string
+	}{
+		{
+			name:       "No command",
+			args:       []string{},
+			wantStderr: "Usage: snippet",
+		},
+		{
+			name:       "Unknown command",
+			args:       []string{"delete"},
+			wantStderr: `unknown command "delete"`,
+		},
+		{
+			name:       "Get without slug",
+			args:       []string{"get"},
+			wantStderr: "Usage: snippet get [flags] <slug>",
+		},
+		{
+			name:       "Search without query",
+			args:       []string{"search"},
+			wantStderr: "Usage: snippet search [flags] <query>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			args := append([]string{"-config", path}, tt.args...)
+
+			err := run(args, strings.NewReader(""), &stdout, &stderr)
+			assert.Equal(t, errors.Is(err, errUsage), true)
+			assert.StringContains(t, stderr.String(), tt.wantStderr)
+		})
+	}
+}
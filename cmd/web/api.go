@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"thienel/lets-go/internal/models"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// maxJSONBytes limits the size of API request bodies.
+const maxJSONBytes = 1 << 20
+
+// envelope is the top-level object of every API response.
+type envelope map[string]any
+
+func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope) {
+	js, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(js, '\n'))
+}
+
+// apiError writes a JSON error body of the form {"error": message}.
+func (app *application) apiError(w http.ResponseWriter, status int, message string) {
+	app.writeJSON(w, status, envelope{"error": message})
+}
+
+func (app *application) apiServerError(w http.ResponseWriter, err error) {
+	app.errorLog.Output(2, err.Error())
+	app.apiError(w, http.StatusInternalServerError,
+		"the server encountered a problem and could not process your request")
+}
+
+func (app *application) invalidTokenResponse(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	app.apiError(w, http.StatusUnauthorized, "invalid or missing API token")
+}
+
+func (app *application) apiNotFound(w http.ResponseWriter) {
+	app.apiError(w, http.StatusNotFound, "the requested resource could not be found")
+}
+
+// apiValidationError reports the failed checks of a validated form, keyed
+// by field name as in validator.Validator.FieldErrors.
+func (app *application) apiValidationError(w http.ResponseWriter,
+	fieldErrors map[string]string) {
+	app.writeJSON(w, http.StatusUnprocessableEntity, envelope{
+		"error":        "the request failed validation",
+		"field_errors": fieldErrors,
+	})
+}
+
+var errUnsupportedMediaType = errors.New("Content-Type must be application/json")
+
+// readJSON decodes a single JSON object from the request body into dst.
+// Requiring the application/json content type also means browsers can't
+// send these requests cross-site without a CORS preflight.
+func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		return errUnsupportedMediaType
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxJSONBytes)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err != nil {
+		var syntaxError *json.SyntaxError
+		var typeError *json.UnmarshalTypeError
+		var maxBytesError *http.MaxBytesError
+
+		switch {
+		case errors.As(err, &syntaxError),
+			errors.Is(err, io.ErrUnexpectedEOF):
+			return errors.New("body contains badly-formed JSON")
+		case errors.As(err, &typeError):
+			return fmt.Errorf("body contains the wrong type for field %q",
+				typeError.Field)
+		case errors.Is(err, io.EOF):
+			return errors.New("body must not be empty")
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			return fmt.Errorf("body contains unknown field %s",
+				strings.TrimPrefix(err.Error(), "json: unknown field "))
+		case errors.As(err, &maxBytesError):
+			return fmt.Errorf("body must not be larger than %d bytes",
+				maxBytesError.Limit)
+		default:
+			return err
+		}
+	}
+
+	if dec.More() {
+		return errors.New("body must only contain a single JSON object")
+	}
+
+	return nil
+}
+
+// withoutContent returns copies of snippets with their content left out,
+// as listings send them.
+func withoutContent(snippets []*models.Snippet) []*models.Snippet {
+	out := make([]*models.Snippet, 0, len(snippets))
+	for _, s := range snippets {
+		c := *s
+		c.Content = ""
+		out = append(out, &c)
+	}
+
+	return out
+}
+
+func (app *application) apiSnippetList(w http.ResponseWriter, r *http.Request) {
+	var after, before *models.Cursor
+	var err error
+
+	if s := r.URL.Query().Get("after"); s != "" {
+		after, err = models.ParseCursor(s)
+	} else if s := r.URL.Query().Get("before"); s != "" {
+		before, err = models.ParseCursor(s)
+	}
+	if err != nil {
+		app.apiError(w, http.StatusBadRequest, "invalid cursor")
+		return
+	}
+
+	limit := snippetsPerPage
+	if s := r.URL.Query().Get("limit"); s != "" {
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > 100 {
+			app.apiError(w, http.StatusBadRequest,
+				"limit must be a number between 1 and 100")
+			return
+		}
+	}
+
+	page, err := app.snippets.Page(after, before, limit)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	data := envelope{"snippets": withoutContent(page.Snippets)}
+	if page.Next != nil {
+		data["next"] = page.Next.String()
+	}
+	if page.Prev != nil {
+		data["prev"] = page.Prev.String()
+	}
+
+	app.writeJSON(w, http.StatusOK, data)
+}
+
+// apiSnippetSearch serves a page of search results. Search ranks by
+// relevance rather than date, so it pages by number instead of by cursor.
+func (app *application) apiSnippetSearch(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		app.apiError(w, http.StatusBadRequest, "q must not be blank")
+		return
+	}
+
+	page := 1
+	if s := r.URL.Query().Get("page"); s != "" {
+		var err error
+		page, err = strconv.Atoi(s)
+		if err != nil || page < 1 {
+			app.apiError(w, http.StatusBadRequest, "page must be a positive number")
+			return
+		}
+	}
+
+	results, more, err := app.snippets.Search(query, page)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	data := envelope{"snippets": withoutContent(results)}
+	if more {
+		data["next_page"] = page + 1
+	}
+
+	app.writeJSON(w, http.StatusOK, data)
+}
+
+func (app *application) apiSnippetGet(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	snippet, err := app.snippets.GetBySlug(params.ByName("slug"))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiNotFound(w)
+		} else {
+			app.apiServerError(w, err)
+		}
+		return
+	}
+
+	if snippet.Visibility == models.VisibilityPrivate &&
+		snippet.UserId != app.authenticatedUserID(r) {
+		app.apiNotFound(w)
+		return
+	}
+
+	if snippet.BurnAfterReading {
+		app.apiError(w, http.StatusForbidden,
+			"burn-after-reading snippets can only be read in the browser")
+		return
+	}
+
+	if !app.isUnlocked(r, snippet) {
+		app.apiError(w, http.StatusForbidden, "this snippet is password-protected")
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"snippet": snippet})
+}
+
+// snippetFormFromInput converts an API request body into a
+// snippetCreateForm so that it goes through the same validation as the HTML
+// form. Fields left out take the same defaults as the form.
+func snippetFormFromInput(in *models.SnippetInput) snippetCreateForm {
+	form := snippetCreateForm{
+		Title:            in.Title,
+		Content:          in.Content,
+		Language:         in.Language,
+		Visibility:       in.Visibility,
+		BurnAfterReading: in.BurnAfterReading,
+		Password:         in.Password,
+		Tags:             strings.Join(in.Tags, ","),
+		Expires:          in.Expires,
+	}
+
+	if form.Visibility == "" {
+		form.Visibility = models.VisibilityPublic
+	}
+	if form.Expires == "" {
+		form.Expires = "365d"
+	}
+	if in.ExpiresAt != nil {
+		form.ExpiresAt = in.ExpiresAt.UTC().Format(expiresAtLayout)
+	}
+
+	return form
+}
+
+func (app *application) apiSnippetCreate(w http.ResponseWriter, r *http.Request) {
+	var input models.SnippetInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		if errors.Is(err, errUnsupportedMediaType) {
+			app.apiError(w, http.StatusUnsupportedMediaType, err.Error())
+		} else {
+			app.apiError(w, http.StatusBadRequest, err.Error())
+		}
+		return
+	}
+
+	form := snippetFormFromInput(&input)
+	validateSnippetForm(&form)
+
+	if !form.Valid() {
+		app.apiValidationError(w, form.FieldErrors)
+		return
+	}
+
+	_, slug, err := app.snippets.Insert(app.authenticatedUserID(r), form.Title,
+		form.Content, form.Language, form.Visibility, form.expiry(time.Now()),
+		form.BurnAfterReading, form.Password, form.tagList())
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	snippet, err := app.snippets.GetBySlug(slug)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/api/v1/snippets/"+slug)
+	app.writeJSON(w, http.StatusCreated, envelope{"snippet": snippet})
+}
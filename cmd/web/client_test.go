@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"thienel/lets-go/internal/assert"
+	"thienel/lets-go/internal/client"
+	"thienel/lets-go/internal/models"
+	"thienel/lets-go/internal/models/mocks"
+)
+
+// These tests run the command-line tool's API client against the real
+// routes, so that the client and the server agree on the wire format.
+
+func newTestClient(t *testing.T, token string) *client.Client {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	t.Cleanup(ts.Close)
+
+	c := client.New(ts.URL, token)
+	c.HTTPClient = ts.Client()
+	return c
+}
+
+func TestClientList(t *testing.T) {
+	c := newTestClient(t, "")
+
+	list, err := c.List("", 0)
+	assert.NilErr(t, err)
+
+	assert.Equal(t, len(list.Snippets), 1)
+	assert.Equal(t, list.Snippets[0].Slug, "b2xkLXBvbmQx")
+	assert.Equal(t, list.Snippets[0].Title, "An old silent pond")
+	assert.Equal(t, list.Snippets[0].UserName, "Alice")
+	assert.Equal(t, list.Snippets[0].Content, "")
+	assert.Equal(t, list.Next != "", true)
+
+	_, err = c.List("nope", 0)
+	var apiErr *client.Error
+	assert.Equal(t, errors.As(err, &apiErr), true)
+	assert.Equal(t, apiErr.StatusCode, http.StatusBadRequest)
+	assert.Equal(t, apiErr.Message, "invalid cursor")
+}
+
+func TestClientSearch(t *testing.T) {
+	c := newTestClient(t, "")
+
+	results, err := c.Search("pond", 1)
+	assert.NilErr(t, err)
+	assert.Equal(t, len(results.Snippets), 1)
+	assert.Equal(t, results.Snippets[0].Slug, "b2xkLXBvbmQx")
+	assert.Equal(t, results.NextPage, 0)
+
+	results, err = c.Search("nothing like this", 1)
+	assert.NilErr(t, err)
+	assert.Equal(t, len(results.Snippets), 0)
+}
+
+func TestClientGet(t *testing.T) {
+	c := newTestClient(t, "")
+
+	snippet, err := c.Get("b2xkLXBvbmQx")
+	assert.NilErr(t, err)
+	assert.Equal(t, snippet.Title, "An old silent pond")
+	assert.StringContains(t, snippet.Content, "An old silent pond...")
+	assert.Equal(t, len(snippet.Tags), 1)
+	assert.Equal(t, snippet.Tags[0], "poetry")
+	assert.Equal(t, snippet.Visibility, models.VisibilityPublic)
+
+	_, err = c.Get("cHJpdmF0ZS01")
+	var apiErr *client.Error
+	assert.Equal(t, errors.As(err, &apiErr), true)
+	assert.Equal(t, apiErr.StatusCode, http.StatusNotFound)
+
+	// The owner's token can read their private snippet.
+	c.Token = mocks.MockReadToken
+	snippet, err = c.Get("cHJpdmF0ZS01")
+	assert.NilErr(t, err)
+	assert.Equal(t, snippet.Visibility, models.VisibilityPrivate)
+}
+
+func TestClientCreate(t *testing.T) {
+	c := newTestClient(t, mocks.MockReadWriteToken)
+
+	in := &models.SnippetInput{
+		Title:   "O snail",
+		Content: "Climb Mount Fuji,\nBut slowly, slowly!",
+		Expires: "7d",
+		Tags:    []string{"haiku"},
+	}
+
+	snippet, err := c.Create(in)
+	assert.NilErr(t, err)
+	assert.Equal(t, snippet.Slug, "bmV3LXNuaXBw")
+	assert.Equal(t, c.SnippetURL(snippet.Slug), c.BaseURL+"/s/bmV3LXNuaXBw")
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := c.Create(&models.SnippetInput{Content: "No title"})
+
+		var apiErr *client.Error
+		assert.Equal(t, errors.As(err, &apiErr), true)
+		assert.Equal(t, apiErr.StatusCode, http.StatusUnprocessableEntity)
+		assert.Equal(t, apiErr.FieldErrors["title"], "This field cannot be blank")
+	})
+
+	t.Run("Read-only token", func(t *testing.T) {
+		c.Token = mocks.MockReadToken
+		_, err := c.Create(in)
+
+		var apiErr *client.Error
+		assert.Equal(t, errors.As(err, &apiErr), true)
+		assert.Equal(t, apiErr.StatusCode, http.StatusForbidden)
+	})
+}
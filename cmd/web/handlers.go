@@ -3,10 +3,22 @@ package main
 import (
 	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
 	"strconv"
+	"strings"
+	"thienel/lets-go/internal/diff"
+	"thienel/lets-go/internal/lockout"
 	"thienel/lets-go/internal/models"
+	"thienel/lets-go/internal/syntax"
 	"thienel/lets-go/internal/validator"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/julienschmidt/httprouter"
 )
@@ -23,250 +35,1373 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	tags, err := app.snippets.TagCloud(30)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippets = snippets
+	data.Tags = tags
+
+	app.render(w, http.StatusOK, "home.html", data)
+}
+
+func (app *application) tagView(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	name := params.ByName("name")
+	if !validTag(name) {
+		app.notFound(w)
+		return
+	}
+
+	snippets, err := app.snippets.ByTag(name)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
 	data := app.newTemplateData(r)
+	data.Tag = name
 	data.Snippets = snippets
 
-	app.render(w, http.StatusOK, "home.html", data)
+	app.render(w, http.StatusOK, "tag.html", data)
+}
+
+const snippetsPerPage = 10
+
+func (app *application) snippetBrowse(w http.ResponseWriter, r *http.Request) {
+	var after, before *models.Cursor
+	var err error
+
+	if s := r.URL.Query().Get("after"); s != "" {
+		after, err = models.ParseCursor(s)
+	} else if s := r.URL.Query().Get("before"); s != "" {
+		before, err = models.ParseCursor(s)
+	}
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	page, err := app.snippets.Page(after, before, snippetsPerPage)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippets = page.Snippets
+	data.Pagination = &pagination{}
+	if page.Prev != nil {
+		data.Pagination.Prev = "/snippets?before=" + page.Prev.String()
+	}
+	if page.Next != nil {
+		data.Pagination.Next = "/snippets?after=" + page.Next.String()
+	}
+
+	app.render(w, http.StatusOK, "browse.html", data)
+}
+
+func (app *application) search(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	page := 1
+	if s := r.URL.Query().Get("page"); s != "" {
+		var err error
+		page, err = strconv.Atoi(s)
+		if err != nil || page < 1 {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	data := app.newTemplateData(r)
+	data.SearchQuery = query
+
+	if query != "" {
+		snippets, more, err := app.snippets.Search(query, page)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		data.Snippets = snippets
+		data.Pagination = &pagination{}
+		if page > 1 {
+			data.Pagination.Prev = searchURL(query, page-1)
+		}
+		if more {
+			data.Pagination.Next = searchURL(query, page+1)
+		}
+	}
+
+	app.render(w, http.StatusOK, "search.html", data)
+}
+
+func searchURL(query string, page int) string {
+	v := url.Values{}
+	v.Set("q", query)
+	v.Set("page", strconv.Itoa(page))
+	return "/search?" + v.Encode()
+}
+
+func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.viewableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+
+	if !app.isUnlocked(r, snippet) {
+		data.Form = snippetUnlockForm{}
+		app.render(w, http.StatusOK, "unlock.html", data)
+		return
+	}
+
+	// Burn-after-reading snippets are only revealed by the POST from the
+	// confirmation page, so that link previewers fetching the URL don't
+	// destroy them.
+	if snippet.BurnAfterReading {
+		app.render(w, http.StatusOK, "burn.html", data)
+		return
+	}
+
+	app.render(w, http.StatusOK, "view.html", data)
+}
+
+func (app *application) snippetBurnPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.viewableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.isUnlocked(r, snippet) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	burned, err := app.snippets.Burn(snippet.Slug)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = burned
+
+	w.Header().Set("Cache-Control", "no-store")
+	app.render(w, http.StatusOK, "view.html", data)
+}
+
+type snippetUnlockForm struct {
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
+// snippetUnlockPolicy locks a protected snippet's unlock form for a while
+// after five wrong passwords, so that the password can't be guessed.
+var snippetUnlockPolicy = lockout.Policy{
+	Free:      5,
+	LockAfter: 5,
+	LockFor:   15 * time.Minute,
+}
+
+func snippetUnlockKey(snippetId int) string {
+	return "snippet:" + strconv.Itoa(snippetId)
+}
+
+// snippetUnlockPost checks the password for a protected snippet and, if it
+// is correct, remembers in the session that the snippet has been unlocked.
+// Wrong passwords are rate limited per snippet.
+func (app *application) snippetUnlockPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.viewableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	if app.isUnlocked(r, snippet) {
+		http.Redirect(w, r, snippetURL(snippet.Slug, ""), http.StatusSeeOther)
+		return
+	}
+
+	var form snippetUnlockForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+
+	// The attempt is counted before the password is checked, so that
+	// passwords can't be guessed in parallel.
+	key := snippetUnlockKey(snippet.Id)
+	res, err := app.snippetUnlockGuard.Reserve(key)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if !res.Allowed() {
+		form.AddNonFieldError("Too many incorrect passwords, please try again later")
+		data.Form = form
+		app.render(w, http.StatusTooManyRequests, "unlock.html", data)
+		return
+	}
+
+	err = app.snippets.Unlock(snippet.Id, form.Password)
+	if errors.Is(err, models.ErrInvalidCredentials) {
+		form.AddNonFieldError("Password is incorrect")
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "unlock.html", data)
+		return
+	}
+
+	// Only wrong passwords count against the snippet.
+	releaseErr := app.snippetUnlockGuard.Release(key, res)
+	if releaseErr != nil {
+		app.serverError(w, releaseErr)
+		return
+	}
+
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	unlocked, _ := app.sessionManager.Get(r.Context(), "unlockedSnippets").([]int)
+	app.sessionManager.Put(r.Context(), "unlockedSnippets", append(unlocked, snippet.Id))
+
+	http.Redirect(w, r, snippetURL(snippet.Slug, ""), http.StatusSeeOther)
+}
+
+// snippetRedirect returns a handler for the old numeric snippet URLs that
+// redirects to the same page under the snippet's slug. Only public
+// snippets, and the user's own, are redirected so that ids can't be used to
+// discover the slugs of unlisted or private snippets.
+func (app *application) snippetRedirect(suffix string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snippet, ok := app.snippetByID(w, r)
+		if !ok {
+			return
+		}
+
+		if snippet.Visibility != models.VisibilityPublic &&
+			snippet.UserId != app.authenticatedUserID(r) {
+			app.notFound(w)
+			return
+		}
+
+		target := snippetURL(snippet.Slug, suffix)
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	}
+}
+
+func (app *application) snippetRaw(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.readableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(snippet.Content))
+}
+
+func (app *application) snippetDownload(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.readableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	disposition := mime.FormatMediaType("attachment", map[string]string{
+		"filename": snippetFilename(snippet),
+	})
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", disposition)
+	w.Write([]byte(snippet.Content))
+}
+
+var filenameUnsafeRX = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// snippetFilename derives a download filename from the snippet's title and
+// language, e.g. "Hello, World!" in Go becomes "hello-world.go".
+func snippetFilename(s *models.Snippet) string {
+	base := filenameUnsafeRX.ReplaceAllString(strings.ToLower(s.Title), "-")
+	base = strings.Trim(base, "-")
+	if len(base) > 50 {
+		base = strings.TrimRight(base[:50], "-")
+	}
+	if base == "" {
+		base = fmt.Sprintf("snippet-%d", s.Id)
+	}
+
+	return base + syntax.Extension(s.Language)
+}
+
+func (app *application) snippetHistory(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.readableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	revisions, err := app.snippets.Revisions(snippet.Id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Revisions = revisions
+
+	app.render(w, http.StatusOK, "history.html", data)
+}
+
+func (app *application) snippetDiff(w http.ResponseWriter, r *http.Request) {
+	fromId, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	toId, err := strconv.Atoi(r.URL.Query().Get("to"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	snippet, ok := app.readableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	from, err := app.snippets.GetRevision(snippet.Id, fromId)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	to, err := app.snippets.GetRevision(snippet.Id, toId)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.DiffFrom = from
+	data.DiffTo = to
+	data.Diff = diff.Unified(from.Content, to.Content, 3)
+
+	app.render(w, http.StatusOK, "diff.html", data)
+}
+
+func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = snippetCreateForm{
+		Visibility: models.VisibilityPublic,
+		Expires:    "365d",
+	}
+
+	app.render(w, http.StatusOK, "create.html", data)
+}
+
+type snippetCreateForm struct {
+	Title               string `form:"title"`
+	Content             string `form:"content"`
+	Language            string `form:"language"`
+	Visibility          string `form:"visibility"`
+	BurnAfterReading    bool   `form:"burn"`
+	Password            string `form:"password"`
+	Tags                string `form:"tags"`
+	Expires             string `form:"expires"`
+	ExpiresAt           string `form:"expires_at"`
+	validator.Validator `form:"-"`
+}
+
+// expiryDurations are the relative choices for the expires field of the
+// snippet form.
+var expiryDurations = map[string]time.Duration{
+	"10m":  10 * time.Minute,
+	"1h":   time.Hour,
+	"1d":   24 * time.Hour,
+	"7d":   7 * 24 * time.Hour,
+	"365d": 365 * 24 * time.Hour,
+}
+
+const (
+	expiresNever  = "never"
+	expiresCustom = "custom"
+
+	// expiresAtLayout is the format of the datetime-local expires_at field,
+	// which is interpreted as UTC.
+	expiresAtLayout = "2006-01-02T15:04"
+)
+
+// expiry returns when a snippet created from the form at now should
+// expire, or the zero time if it never should. The form must already have
+// been validated.
+func (f *snippetCreateForm) expiry(now time.Time) time.Time {
+	switch f.Expires {
+	case expiresNever:
+		return time.Time{}
+	case expiresCustom:
+		t, _ := time.Parse(expiresAtLayout, f.ExpiresAt)
+		return t
+	default:
+		return now.Add(expiryDurations[f.Expires])
+	}
+}
+
+// editExpiry is like expiry, for a form editing snippet. The form only
+// shows the expiry to the minute, so an expiry left as it was keeps its
+// seconds rather than moving to the start of the minute.
+func (f *snippetCreateForm) editExpiry(snippet *models.Snippet, now time.Time) time.Time {
+	if f.Expires == expiresCustom && !snippet.Expires.IsZero() &&
+		f.ExpiresAt == snippet.Expires.UTC().Format(expiresAtLayout) {
+		return snippet.Expires
+	}
+
+	return f.expiry(now)
+}
+
+// tagList splits the comma or space separated tags field into normalised,
+// de-duplicated tag names.
+func (f *snippetCreateForm) tagList() []string {
+	fields := strings.FieldsFunc(strings.ToLower(f.Tags), func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+
+	tags := []string{}
+	for _, tag := range fields {
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+// validText reports whether s is UTF-8 text that can be stored and shown as
+// snippet content, which rules out NUL characters.
+func validText(s string) bool {
+	return utf8.ValidString(s) && !strings.ContainsRune(s, 0)
+}
+
+func validTag(tag string) bool {
+	return validator.MaxChars(tag, 20) && validator.Matches(tag, validator.TagRX)
+}
+
+// validateSnippetForm checks a submitted snippet form.
+func validateSnippetForm(form *snippetCreateForm) {
+	form.CheckField(validator.NotBlank(form.Title), "title",
+		"This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Title, 100), "title",
+		"This field cannot be more than 100 characters long")
+	form.CheckField(validator.NotBlank(form.Content), "content",
+		"This field cannot be blank")
+	form.CheckField(len(form.Content) <= maxContentBytes, "content",
+		fmt.Sprintf("This field cannot be larger than %d KB", maxContentKB))
+	form.CheckField(validText(form.Content), "content",
+		"This field must be UTF-8 text without NUL characters")
+	form.CheckField(validator.PermittedValue(form.Language, syntax.Names()...),
+		"language", "This field must be one of the listed languages")
+	form.CheckField(validator.PermittedValue(form.Visibility, models.VisibilityPublic,
+		models.VisibilityUnlisted, models.VisibilityPrivate),
+		"visibility", "This field must be public, unlisted or private")
+	form.CheckField(!form.BurnAfterReading || form.Visibility != models.VisibilityPublic,
+		"visibility", "Burn-after-reading snippets cannot be public")
+	form.CheckField(form.Password == "" || validator.Minchars(form.Password, 8),
+		"password", "This field must be at least 8 characters long")
+	form.CheckField(len(form.Password) <= 72, "password",
+		"This field cannot be more than 72 bytes long")
+	_, relative := expiryDurations[form.Expires]
+	form.CheckField(relative || form.Expires == expiresCustom ||
+		form.Expires == expiresNever, "expires",
+		"This field must be one of the listed options")
+	if form.Expires == expiresCustom {
+		at, err := time.Parse(expiresAtLayout, form.ExpiresAt)
+		form.CheckField(err == nil, "expires",
+			"This field must be a valid date and time")
+		form.CheckField(err != nil || at.After(time.Now()), "expires",
+			"This field must be in the future")
+	}
+
+	tags := form.tagList()
+	form.CheckField(validator.MaxItems(tags, 5), "tags",
+		"This field cannot have more than 5 tags")
+	form.CheckField(validator.AllValid(tags, validTag), "tags",
+		"Tags must be at most 20 letters, digits or + # . _ - characters")
+}
+
+const (
+	// maxContentBytes keeps snippet content within the TEXT content column,
+	// whichever way the snippet was created.
+	maxContentBytes = 65535
+	maxContentKB    = (maxContentBytes + 1) / 1024
+	// maxFormBytes limits the size of a whole form body, uploads included.
+	maxFormBytes = 1 << 20
+)
+
+// readUpload fills in the form from the uploaded file, if there is one. The
+// file replaces the content field, and its name supplies the title and
+// language unless they were given. Files that are too large or aren't
+// UTF-8 text are reported as errors on the file field.
+func readUpload(r *http.Request, form *snippetCreateForm) error {
+	if r.MultipartForm == nil {
+		return nil
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		if errors.Is(err, http.ErrMissingFile) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	if header.Size > maxContentBytes {
+		form.AddFieldError("file", fmt.Sprintf("This file cannot be larger than %d KB",
+			maxContentKB))
+		return nil
+	}
+
+	b, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+
+	if !validText(string(b)) {
+		form.AddFieldError("file", "This file must be UTF-8 text")
+		return nil
+	}
+
+	form.Content = string(b)
+	if !validator.NotBlank(form.Title) {
+		form.Title = header.Filename
+	}
+	if form.Language == syntax.Auto {
+		form.Language = syntax.ForFilename(header.Filename)
+	}
+
+	return nil
+}
+
+func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form snippetCreateForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = readUpload(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	validateSnippetForm(&form)
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "create.html", data)
+		return
+	}
+
+	userId := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	_, slug, err := app.snippets.Insert(userId, form.Title, form.Content,
+		form.Language, form.Visibility, form.expiry(time.Now()),
+		form.BurnAfterReading, form.Password, form.tagList())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully created!")
+
+	http.Redirect(w, r, snippetURL(slug, ""), http.StatusSeeOther)
+}
+
+func (app *application) snippetEdit(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	form := snippetCreateForm{
+		Title:            snippet.Title,
+		Content:          snippet.Content,
+		Language:         snippet.Language,
+		Visibility:       snippet.Visibility,
+		BurnAfterReading: snippet.BurnAfterReading,
+		Tags:             strings.Join(snippet.Tags, ", "),
+		Expires:          expiresNever,
+	}
+	if !snippet.Expires.IsZero() {
+		form.Expires = expiresCustom
+		form.ExpiresAt = snippet.Expires.UTC().Format(expiresAtLayout)
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Form = form
+
+	app.render(w, http.StatusOK, "edit.html", data)
+}
+
+func (app *application) snippetEditPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	var form snippetCreateForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// Whether a snippet burns after reading is fixed when it is created.
+	form.BurnAfterReading = snippet.BurnAfterReading
+
+	validateSnippetForm(&form)
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "edit.html", data)
+		return
+	}
+
+	err = app.snippets.Update(snippet.Id, form.Title, form.Content, form.Language,
+		form.Visibility, form.editExpiry(snippet, time.Now()), form.tagList())
+	if err != nil {
+		// The snippet may have been deleted, or expired, since it was
+		// looked up.
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully updated!")
+
+	http.Redirect(w, r, snippetURL(snippet.Slug, ""), http.StatusSeeOther)
+}
+
+func (app *application) snippetDeletePost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.snippets.Delete(snippet.Id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet moved to trash")
+
+	http.Redirect(w, r, "/account/trash", http.StatusSeeOther)
+}
+
+type userSignupForm struct {
+	Name                string `form:"name"`
+	Email               string `form:"email"`
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) userSignup(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = userSignupForm{}
+	app.render(w, http.StatusOK, "signup.html", data)
+}
+
+func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
+	var form userSignupForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRX),
+		"email", "This field must be a valid email address")
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+	form.CheckField(validator.Minchars(form.Password, 8),
+		"password", "This field must be at least 8 characters long")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "signup.html", data)
+		return
+	}
+
+	id, err := app.users.Insert(form.Name, form.Email, form.Password)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateEmail) {
+			form.AddFieldError("email", "Email address is already in use")
+
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, http.StatusUnprocessableEntity, "signup.html", data)
+		} else {
+			app.serverError(w, err)
+		}
+
+		return
+	}
+
+	// The user can ask for another link from their account page, so a
+	// failure to send this one needn't fail the signup.
+	user := &models.User{Id: id, Name: form.Name, Email: form.Email}
+	app.background(func() error {
+		return app.sendEmailVerification(user)
+	})
+
+	app.sessionManager.Put(r.Context(), "flash",
+		"Your signup was successful. We've emailed you a link to verify your address. Please log in")
+
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+type userLoginForm struct {
+	Email               string `form:"email"`
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) userLogin(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = userLoginForm{}
+	app.render(w, http.StatusOK, "login.html", data)
+}
+
+func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
+	var form userLoginForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email",
+		"This field must be a valid email address")
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "login.html", data)
+		return
+	}
+
+	attempt, blocked, err := app.reserveLogin(r, form.Email)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if blocked != "" {
+		form.AddNonFieldError(blocked)
+
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusTooManyRequests, "login.html", data)
+		return
+	}
+
+	id, err := app.users.Authenticate(form.Email, form.Password)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			form.AddNonFieldError("Email or password is incorrect")
+
+			err = app.loginFailed(r, form.Email, attempt)
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+
+			// Say straight away if that was one failure too many.
+			blocked, err = app.loginBlocked(r, form.Email)
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+			if blocked != "" {
+				form.AddNonFieldError(blocked)
+			}
+
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, http.StatusUnprocessableEntity, "login.html", data)
+		} else {
+			app.serverError(w, errors.Join(err, app.loginAborted(r, form.Email, attempt)))
+		}
+
+		return
+	}
+
+	err = app.loginSucceeded(r, form.Email, attempt)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	user, err := app.users.Get(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Users with two-factor authentication aren't logged in until they
+	// have also entered a code, on the next page.
+	if user.TwoFactorEnabled {
+		err = app.sessionManager.RenewToken(r.Context())
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		app.sessionManager.Put(r.Context(), "twoFactorUserID", id)
+		app.sessionManager.Put(r.Context(), "twoFactorExpires",
+			time.Now().Add(twoFactorLoginTTL).Unix())
+
+		http.Redirect(w, r, "/user/login/2fa", http.StatusSeeOther)
+		return
+	}
+
+	app.logIn(w, r, id, "You've been logged in successfully")
+}
+
+// logIn puts the user's id in a new session and sends them on to the page
+// they were trying to reach. The session is recorded so that the user can
+// see it on their account page and log it out from elsewhere.
+func (app *application) logIn(w http.ResponseWriter, r *http.Request, id int, flash string) {
+	err := app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	key, err := app.userSessions.Insert(id, r.UserAgent(), clientIP(r),
+		app.sessionManager.Lifetime)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "authenticatedUserID", id)
+	app.sessionManager.Put(r.Context(), "sessionKey", key)
+	app.sessionManager.Put(r.Context(), "flash", flash)
+
+	path := app.sessionManager.PopString(r.Context(), "redirectPathAfterLogin")
+
+	if path != "" {
+		http.Redirect(w, r, path, http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+}
+
+func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
+	err := app.userSessions.DeleteByKey(app.sessionManager.GetString(r.Context(), "sessionKey"))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+	app.sessionManager.Remove(r.Context(), "sessionKey")
+	app.sessionManager.Put(r.Context(), "flash", "You've been logged out successfully!")
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// passwordResetTTL is how long an emailed password reset link works for.
+const passwordResetTTL = time.Hour
+
+// resetEmailPolicy limits how many reset links can be asked for one address,
+// so that the form can't be used to flood someone's inbox, and resetIPPolicy
+// how many one client address can ask for across all addresses.
+var (
+	resetEmailPolicy = lockout.Policy{
+		Free:      3,
+		LockAfter: 3,
+		LockFor:   time.Hour,
+	}
+	resetIPPolicy = lockout.Policy{
+		Free:      20,
+		LockAfter: 20,
+		LockFor:   time.Hour,
+	}
+)
+
+func resetEmailKey(email string) string {
+	return "reset:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func resetIPKey(ip string) string {
+	return "reset-ip:" + ip
+}
+
+// checkNewPassword validates a new password and its confirmation, as
+// entered in the newPassword and confirmNewPassword fields.
+func checkNewPassword(v *validator.Validator, password, confirmation string) {
+	v.CheckField(validator.NotBlank(password), "newPassword",
+		"New password can not be empty")
+	v.CheckField(validator.Minchars(password, 8), "newPassword",
+		"New password must be at least 8 characters")
+	v.CheckField(validator.NotBlank(confirmation), "confirmNewPassword",
+		"Confirm new password can not be empty")
+	v.CheckField(validator.IsSame(password, confirmation),
+		"confirmNewPassword", "Password is not match")
+}
+
+type forgotPasswordForm struct {
+	Email               string `form:"email"`
+	validator.Validator `form:"-"`
+}
+
+// reserveResetEmail counts a request for a reset link for email from this
+// request's address. Every request counts, whether or not the address has
+// an account, so that being refused doesn't give that away. It returns the
+// status that refused the request, if one did, in which case nothing is
+// counted.
+func (app *application) reserveResetEmail(r *http.Request, email string) (lockout.Status, error) {
+	ipKey := resetIPKey(clientIP(r))
+
+	ipRes, err := app.resetIPGuard.Reserve(ipKey)
+	if err != nil || !ipRes.Allowed() {
+		return ipRes.Status, err
+	}
+
+	emailRes, err := app.resetEmailGuard.Reserve(resetEmailKey(email))
+	if err != nil || emailRes.Allowed() {
+		return emailRes.Status, err
+	}
+
+	// The address only pays for requests that were made.
+	return emailRes.Status, app.resetIPGuard.Release(ipKey, ipRes)
+}
+
+func (app *application) userForgotPassword(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = forgotPasswordForm{}
+	app.render(w, http.StatusOK, "forgotPassword.html", data)
+}
+
+func (app *application) userForgotPasswordPost(w http.ResponseWriter, r *http.Request) {
+	var form forgotPasswordForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email",
+		"This field must be a valid email address")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "forgotPassword.html", data)
+		return
+	}
+
+	status, err := app.reserveResetEmail(r, form.Email)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if !status.Allowed() {
+		form.AddNonFieldError(fmt.Sprintf("Too many reset links have been asked for. "+
+			"Please try again in %s", humanWait(status.Wait)))
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusTooManyRequests, "forgotPassword.html", data)
+		return
+	}
+
+	// The response is the same whether or not the address has an account,
+	// so the form can't be used to find out who has signed up. The account
+	// is looked up and emailed in the background, so that neither shows in
+	// how long the response takes, and for the same reason failing to send
+	// the email is only logged.
+	app.background(func() error {
+		user, err := app.users.GetByEmail(form.Email)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				return nil
+			}
+			return err
+		}
+
+		return app.sendPasswordReset(user)
+	})
+
+	app.sessionManager.Put(r.Context(), "flash",
+		"If that address has an account, we've emailed it a link to reset the password")
+
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+func (app *application) sendPasswordReset(user *models.User) error {
+	token, err := app.passwordResets.Insert(user.Id, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	return app.mailer.Send(user.Email, "password_reset.tmpl", map[string]any{
+		"Name": user.Name,
+		"URL":  app.baseURL + "/user/password/reset?token=" + url.QueryEscape(token),
+		"TTL":  "an hour",
+	})
 }
 
-func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
-	params := httprouter.ParamsFromContext(r.Context())
-	id, err := strconv.Atoi(params.ByName("id"))
-	if err != nil || id < 1 {
-		app.notFound(w)
-		return
+// emailVerificationTTL is how long an emailed verification link works for.
+const emailVerificationTTL = 24 * time.Hour
+
+// verifyResendPolicy makes users wait a minute after asking for a new
+// verification link, twice as long after each further one, and stops them
+// for a day after ten.
+var verifyResendPolicy = lockout.Policy{
+	BaseDelay: time.Minute,
+	MaxDelay:  time.Hour,
+	LockAfter: 10,
+	LockFor:   24 * time.Hour,
+}
+
+func verifyResendKey(userId int) string {
+	return "verify:" + strconv.Itoa(userId)
+}
+
+func (app *application) sendEmailVerification(user *models.User) error {
+	token, err := app.verifications.Insert(user.Id, emailVerificationTTL)
+	if err != nil {
+		return err
 	}
 
-	snippet, err := app.snippets.Get(id)
+	return app.mailer.Send(user.Email, "email_verification.tmpl", map[string]any{
+		"Name": user.Name,
+		"URL":  app.baseURL + "/user/verify?token=" + url.QueryEscape(token),
+		"TTL":  "a day",
+	})
+}
+
+func (app *application) userVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	_, err := app.verifications.Verify(r.URL.Query().Get("token"))
 	if err != nil {
-		if errors.Is(err, models.ErrNoRecord) {
-			app.notFound(w)
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			app.sessionManager.Put(r.Context(), "flash",
+				"That verification link is invalid or has expired")
+			http.Redirect(w, r, "/account/view", http.StatusSeeOther)
 		} else {
-			app.errorLog.Print(w, err)
 			app.serverError(w, err)
 		}
 		return
 	}
 
-	data := app.newTemplateData(r)
-	data.Snippet = snippet
-
-	app.render(w, http.StatusOK, "view.html", data)
-}
-
-func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
-	data := app.newTemplateData(r)
-	data.Form = snippetCreateForm{
-		Expires: 365,
-	}
-
-	app.render(w, http.StatusOK, "create.html", data)
-}
+	app.sessionManager.Put(r.Context(), "flash", "Your email address has been verified")
 
-type snippetCreateForm struct {
-	Title               string `form:"title"`
-	Content             string `form:"content"`
-	Expires             int    `form:"expires"`
-	validator.Validator `form:"-"`
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
 }
 
-func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request) {
-	var form snippetCreateForm
-
-	err := app.decodePostForm(r, &form)
+func (app *application) accountVerifyResendPost(w http.ResponseWriter, r *http.Request) {
+	user, err := app.users.Get(app.authenticatedUserID(r))
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.serverError(w, err)
 		return
 	}
 
-	form.CheckField(validator.NotBlank(form.Title), "title",
-		"This field cannot be blank")
-	form.CheckField(validator.MaxChars(form.Title, 100), "title",
-		"This field cannot be more than 100 characters long")
-	form.CheckField(validator.NotBlank(form.Content), "content",
-		"This field cannot be blank")
-	form.CheckField(validator.PermittedValue(form.Expires, 1, 7, 365),
-		"expires", "This field must equal 1, 7 or 365")
-
-	if !form.Valid() {
-		data := app.newTemplateData(r)
-		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "create.html", data)
+	if user.EmailVerified {
+		app.sessionManager.Put(r.Context(), "flash",
+			"Your email address is already verified")
+		http.Redirect(w, r, "/account/view", http.StatusSeeOther)
 		return
 	}
 
-	id, err := app.snippets.Insert(form.Title, form.Content, form.Expires)
+	// Each link asked for makes the user wait longer for the next one, so
+	// that the button can't be used to flood their inbox.
+	res, err := app.verifyResendGuard.Reserve(verifyResendKey(user.Id))
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
+	if !res.Allowed() {
+		app.sessionManager.Put(r.Context(), "flash",
+			fmt.Sprintf("Please wait %s before asking for another verification link",
+				humanWait(res.Wait)))
+		http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+		return
+	}
 
-	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully created!")
+	app.background(func() error {
+		return app.sendEmailVerification(user)
+	})
 
-	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+	app.sessionManager.Put(r.Context(), "flash",
+		fmt.Sprintf("We've sent a new verification link to %s", user.Email))
+
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
 }
 
-type userSignupForm struct {
-	Name                string `form:"name"`
-	Email               string `form:"email"`
-	Password            string `form:"password"`
+type resetPasswordForm struct {
+	Token               string `form:"token"`
+	NewPassword         string `form:"newPassword"`
+	ConfirmNewPassword  string `form:"confirmNewPassword"`
 	validator.Validator `form:"-"`
 }
 
-func (app *application) userSignup(w http.ResponseWriter, r *http.Request) {
-	data := app.newTemplateData(r)
-	data.Form = userSignupForm{}
-	app.render(w, http.StatusOK, "signup.html", data)
+func (app *application) invalidResetLink(w http.ResponseWriter, r *http.Request) {
+	app.sessionManager.Put(r.Context(), "flash",
+		"That password reset link is invalid or has expired")
+	http.Redirect(w, r, "/user/password/forgot", http.StatusSeeOther)
 }
 
-func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
-	var form userSignupForm
+func (app *application) userResetPassword(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+
+	_, err := app.passwordResets.Get(token)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			app.invalidResetLink(w, r)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = resetPasswordForm{Token: token}
+	app.render(w, http.StatusOK, "resetPassword.html", data)
+}
 
+func (app *application) userResetPasswordPost(w http.ResponseWriter, r *http.Request) {
+	var form resetPasswordForm
 	err := app.decodePostForm(r, &form)
 	if err != nil {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
-	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
-	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
-	form.CheckField(validator.Matches(form.Email, validator.EmailRX),
-		"email", "This field must be a valid email address")
-	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
-	form.CheckField(validator.Minchars(form.Password, 8),
-		"password", "This field must be at least 8 characters long")
+	checkNewPassword(&form.Validator, form.NewPassword, form.ConfirmNewPassword)
 
 	if !form.Valid() {
 		data := app.newTemplateData(r)
 		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "signup.html", data)
+		app.render(w, http.StatusUnprocessableEntity, "resetPassword.html", data)
 		return
 	}
 
-	err = app.users.Insert(form.Name, form.Email, form.Password)
+	userId, err := app.passwordResets.ResetPassword(form.Token, form.NewPassword)
 	if err != nil {
-		if errors.Is(err, models.ErrDuplicateEmail) {
-			form.AddFieldError("email", "Email address is already in use")
-
-			data := app.newTemplateData(r)
-			data.Form = form
-			app.render(w, http.StatusUnprocessableEntity, "signup.html", data)
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			app.invalidResetLink(w, r)
 		} else {
 			app.serverError(w, err)
 		}
+		return
+	}
 
+	// Whoever knew the old password may still be logged in with it.
+	_, err = app.userSessions.DeleteOthers(userId, "")
+	if err != nil {
+		app.serverError(w, err)
 		return
 	}
 
-	app.sessionManager.Put(r.Context(), "flash", "Your signup was successful.  Please log in")
+	app.sessionManager.Put(r.Context(), "flash",
+		"Your password has been reset. Please log in with your new password")
 
 	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 }
 
-type userLoginForm struct {
-	Email               string `form:"email"`
-	Password            string `form:"password"`
-	validator.Validator `form:"-"`
+func ping(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("OK"))
 }
 
-func (app *application) userLogin(w http.ResponseWriter, r *http.Request) {
+func (app *application) about(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
-	data.Form = userLoginForm{}
-	app.render(w, http.StatusOK, "login.html", data)
+	app.render(w, http.StatusOK, "about.html", data)
 }
 
-func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
-	var form userLoginForm
-	err := app.decodePostForm(r, &form)
-	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+func (app *application) account(w http.ResponseWriter, r *http.Request) {
+	data, ok := app.accountData(w, r)
+	if !ok {
 		return
 	}
+	data.Form = tokenCreateForm{Scopes: []string{models.ScopeRead}}
 
-	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
-	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email",
-		"This field must be a valid email address")
-	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+	app.render(w, http.StatusOK, "account.html", data)
+}
 
-	if !form.Valid() {
-		data := app.newTemplateData(r)
-		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "login.html", data)
-		return
-	}
+// accountData loads everything the account page shows. If it returns false
+// a response has already been written.
+func (app *application) accountData(w http.ResponseWriter, r *http.Request) (*templateData, bool) {
+	userId := app.authenticatedUserID(r)
 
-	id, err := app.users.Authenticate(form.Email, form.Password)
+	user, err := app.users.Get(userId)
 	if err != nil {
-		if errors.Is(err, models.ErrInvalidCredentials) {
-			form.AddNonFieldError("Email or password is incorrect")
-
-			data := app.newTemplateData(r)
-			data.Form = form
-			app.render(w, http.StatusUnprocessableEntity, "login.html", data)
+		if errors.Is(err, models.ErrNoRecord) {
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 		} else {
 			app.serverError(w, err)
 		}
+		return nil, false
+	}
 
-		return
+	snippets, err := app.snippets.GetByUser(userId)
+	if err != nil {
+		app.serverError(w, err)
+		return nil, false
 	}
 
-	err = app.sessionManager.RenewToken(r.Context())
+	tokens, err := app.tokens.GetByUser(userId)
 	if err != nil {
 		app.serverError(w, err)
-		return
+		return nil, false
 	}
 
-	app.sessionManager.Put(r.Context(), "authenticatedUserID", id)
-	app.sessionManager.Put(r.Context(), "flash", "You've been logged in successfully")
+	sessions, err := app.userSessions.GetByUser(userId,
+		app.sessionManager.GetString(r.Context(), "sessionKey"))
+	if err != nil {
+		app.serverError(w, err)
+		return nil, false
+	}
 
-	path := app.sessionManager.PopString(r.Context(), "redirectPathAfterLogin")
+	data := app.newTemplateData(r)
+	data.Account = user
+	data.Snippets = snippets
+	data.Tokens = tokens
+	data.Sessions = sessions
+	data.NewToken = app.sessionManager.PopString(r.Context(), "newAPIToken")
 
-	if path != "" {
-		http.Redirect(w, r, path, http.StatusSeeOther)
-		return
-	}
-	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+	return data, true
 }
 
-func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
-	err := app.sessionManager.RenewToken(r.Context())
+type tokenCreateForm struct {
+	Name                string   `form:"name"`
+	Scopes              []string `form:"scopes"`
+	validator.Validator `form:"-"`
+}
+
+func (f tokenCreateForm) HasScope(scope string) bool {
+	return slices.Contains(f.Scopes, scope)
+}
+
+func (app *application) tokenCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form tokenCreateForm
+	err := app.decodePostForm(r, &form)
 	if err != nil {
-		app.serverError(w, err)
+		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
-	app.sessionManager.Remove(r.Context(), "authenticatedUserID")
-	app.sessionManager.Put(r.Context(), "flash", "You've been logged out successfully!")
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Name, 100), "name",
+		"This field cannot be more than 100 characters long")
+	form.CheckField(len(form.Scopes) > 0, "scopes", "Choose at least one scope")
+	form.CheckField(validator.AllValid(form.Scopes, func(scope string) bool {
+		return validator.PermittedValue(scope, models.ScopeRead, models.ScopeWrite)
+	}), "scopes", "This field is invalid")
 
-	http.Redirect(w, r, "/", http.StatusSeeOther)
-}
+	if !form.Valid() {
+		data, ok := app.accountData(w, r)
+		if !ok {
+			return
+		}
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "account.html", data)
+		return
+	}
 
-func ping(w http.ResponseWriter, r *http.Request) {
-	w.Write([]byte("OK"))
-}
+	token, err := app.tokens.Insert(app.authenticatedUserID(r), form.Name, form.Scopes)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
 
-func (app *application) about(w http.ResponseWriter, r *http.Request) {
-	data := app.newTemplateData(r)
-	app.render(w, http.StatusOK, "about.html", data)
+	// The plaintext is only ever shown on the next page load.
+	app.sessionManager.Put(r.Context(), "newAPIToken", token)
+	app.sessionManager.Put(r.Context(), "flash", "Token created")
+
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
 }
 
-func (app *application) account(w http.ResponseWriter, r *http.Request) {
-	userId := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+func (app *application) tokenRevokePost(w http.ResponseWriter, r *http.Request) {
+	id, ok := readIDParam(r)
+	if !ok {
+		app.notFound(w)
+		return
+	}
 
-	user, err := app.users.Get(userId)
+	err := app.tokens.Delete(id, app.authenticatedUserID(r))
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
-			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+			app.notFound(w)
 		} else {
 			app.serverError(w, err)
 		}
 		return
 	}
 
-	data := app.newTemplateData(r)
-	data.Account = user
+	app.sessionManager.Put(r.Context(), "flash", "Token revoked")
 
-	app.render(w, http.StatusOK, "account.html", data)
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
 }
 
 type changePasswordForm struct {
@@ -315,14 +1450,7 @@ func (app *application) passowrdUpdatePost(w http.ResponseWriter, r *http.Reques
 	}
 	form.CheckField(validator.NotBlank(form.CurrentPassword), "currentPassword",
 		"Current password can not be empty")
-	form.CheckField(validator.NotBlank(form.NewPassword), "newPassword",
-		"New password can not be empty")
-	form.CheckField(validator.Minchars(form.NewPassword, 8), "newPassword",
-		"New password must be at least 8 characters")
-	form.CheckField(validator.NotBlank(form.ConfirmNewPassword), "confirmNewPassword",
-		"Confirm new password can not be empty")
-	form.CheckField(validator.IsSame(form.NewPassword, form.ConfirmNewPassword),
-		"confirmNewPassword", "Password is not match")
+	checkNewPassword(&form.Validator, form.NewPassword, form.ConfirmNewPassword)
 
 	if !form.Valid() {
 		data := app.newTemplateData(r)
@@ -334,8 +1462,80 @@ func (app *application) passowrdUpdatePost(w http.ResponseWriter, r *http.Reques
 	err = app.users.ChangePassword(userId, form.NewPassword)
 	if err != nil {
 		app.serverError(w, err)
+		return
+	}
+
+	// Anyone else logged in with the old password is logged out.
+	n, err := app.userSessions.DeleteOthers(userId,
+		app.sessionManager.GetString(r.Context(), "sessionKey"))
+	if err != nil {
+		app.serverError(w, err)
+		return
 	}
 
-	app.sessionManager.Put(r.Context(), "flash", "Change password successfully")
+	flash := "Change password successfully"
+	if n > 0 {
+		flash += fmt.Sprintf(". %s logged out", otherSessions(n))
+	}
+	app.sessionManager.Put(r.Context(), "flash", flash)
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
+
+func (app *application) trash(w http.ResponseWriter, r *http.Request) {
+	userId := app.authenticatedUserID(r)
+
+	snippets, err := app.snippets.Trash(userId)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippets = snippets
+
+	app.render(w, http.StatusOK, "trash.html", data)
+}
+
+func (app *application) trashRestorePost(w http.ResponseWriter, r *http.Request) {
+	id, ok := readIDParam(r)
+	if !ok {
+		app.notFound(w)
+		return
+	}
+
+	err := app.snippets.Restore(id, app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet restored")
+
+	http.Redirect(w, r, "/account/trash", http.StatusSeeOther)
+}
+
+func (app *application) trashPurgePost(w http.ResponseWriter, r *http.Request) {
+	id, ok := readIDParam(r)
+	if !ok {
+		app.notFound(w)
+		return
+	}
+
+	err := app.snippets.Purge(id, app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet permanently deleted")
+
+	http.Redirect(w, r, "/account/trash", http.StatusSeeOther)
+}
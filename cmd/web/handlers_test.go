@@ -1,10 +1,18 @@
 package main
 
 import (
+	"fmt"
+	"maps"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
 	"testing"
 	"thienel/lets-go/internal/assert"
+	"thienel/lets-go/internal/mailer"
+	"thienel/lets-go/internal/models"
+	"thienel/lets-go/internal/models/mocks"
+	"time"
 )
 
 func TestPing(t *testing.T) {
@@ -32,11 +40,34 @@ func TestSnippetView(t *testing.T) {
 		wantBody string
 	}{
 		{
-			name:     "Valid ID",
-			urlPath:  "/snippet/view/1",
+			name:     "Valid slug",
+			urlPath:  "/s/b2xkLXBvbmQx",
 			wantCode: http.StatusOK,
 			wantBody: "An old silent pond...",
 		},
+		{
+			name:     "Highlighted content",
+			urlPath:  "/s/b2xkLXBvbmQx",
+			wantCode: http.StatusOK,
+			wantBody: `<pre class="chroma"><code>An old silent pond...</code></pre>`,
+		},
+		{
+			name:     "Shows author",
+			urlPath:  "/s/b2xkLXBvbmQx",
+			wantCode: http.StatusOK,
+			wantBody: "by Alice",
+		},
+		{
+			name:     "Titled by snippet title",
+			urlPath:  "/s/b2xkLXBvbmQx",
+			wantCode: http.StatusOK,
+			wantBody: "<title>An old silent pond - Snippetbox</title>",
+		},
+		{
+			name:     "Non-existent slug",
+			urlPath:  "/s/doesnotexist",
+			wantCode: http.StatusNotFound,
+		},
 		{
 			name:     "Non-existent ID",
 			urlPath:  "/snippet/view/2",
@@ -190,6 +221,315 @@ func TestUserSignup(t *testing.T) {
 			}
 		})
 	}
+
+	app.wg.Wait()
+	messages := app.mailer.(*mailer.Memory).Messages()
+	assert.Equal(t, len(messages), 1)
+	assert.Equal(t, messages[0].To, validEmail)
+	assert.Equal(t, messages[0].Subject, "Verify your Snippetbox email address")
+	assert.StringContains(t, messages[0].Body,
+		"https://snippets.example.com/user/verify?token="+mocks.MockVerificationToken)
+}
+
+func TestUserVerifyEmail(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name      string
+		token     string
+		wantFlash string
+	}{
+		{
+			name:      "Valid token",
+			token:     mocks.MockVerificationToken,
+			wantFlash: "Your email address has been verified",
+		},
+		{
+			name:      "Invalid token",
+			token:     "expired",
+			wantFlash: "That verification link is invalid or has expired",
+		},
+	}
+
+	ts.login(t, "carol@example.com", "pa$$word")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, _ := ts.get(t, "/user/verify?token="+url.QueryEscape(tt.token))
+
+			assert.Equal(t, code, http.StatusSeeOther)
+			assert.Equal(t, header.Get("Location"), "/account/view")
+
+			_, _, body := ts.get(t, "/account/view")
+			assert.StringContains(t, body, tt.wantFlash)
+		})
+	}
+}
+
+func TestAccountVerifyResend(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	mail := app.mailer.(*mailer.Memory)
+
+	t.Run("Unverified", func(t *testing.T) {
+		ts.login(t, "carol@example.com", "pa$$word")
+
+		_, _, body := ts.get(t, "/account/view")
+		assert.StringContains(t, body, "(not verified)")
+		validCSRFToken := extractCSRFToken(t, body)
+
+		form := url.Values{}
+		form.Add("csrf_token", validCSRFToken)
+		code, header, _ := ts.postForm(t, "/account/verify/resend", form)
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/account/view")
+
+		app.wg.Wait()
+		assert.Equal(t, len(mail.Messages()), 1)
+		assert.Equal(t, mail.Messages()[0].To, "carol@example.com")
+
+		_, _, body = ts.get(t, "/account/view")
+		assert.StringContains(t, body,
+			"We&#39;ve sent a new verification link to carol@example.com")
+	})
+
+	t.Run("Too soon", func(t *testing.T) {
+		_, _, body := ts.get(t, "/account/view")
+
+		form := url.Values{}
+		form.Add("csrf_token", extractCSRFToken(t, body))
+		code, header, _ := ts.postForm(t, "/account/verify/resend", form)
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/account/view")
+
+		app.wg.Wait()
+		assert.Equal(t, len(mail.Messages()), 1)
+
+		_, _, body = ts.get(t, "/account/view")
+		assert.StringContains(t, body, "before asking for another verification link")
+	})
+
+	t.Run("Already verified", func(t *testing.T) {
+		ts.login(t, "alice@example.com", "pa$$word")
+
+		_, _, body := ts.get(t, "/account/view")
+		assert.StringContains(t, body, "(verified)")
+		validCSRFToken := extractCSRFToken(t, body)
+
+		form := url.Values{}
+		form.Add("csrf_token", validCSRFToken)
+		code, _, _ := ts.postForm(t, "/account/verify/resend", form)
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		app.wg.Wait()
+		assert.Equal(t, len(mail.Messages()), 1)
+
+		_, _, body = ts.get(t, "/account/view")
+		assert.StringContains(t, body, "Your email address is already verified")
+	})
+}
+
+func TestUserForgotPassword(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	mail := app.mailer.(*mailer.Memory)
+
+	_, _, body := ts.get(t, "/user/password/forgot")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name         string
+		email        string
+		wantCode     int
+		wantBody     string
+		wantMessages int
+	}{
+		{
+			name:     "Blank email",
+			email:    "",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This field cannot be blank",
+		},
+		{
+			name:     "Invalid email",
+			email:    "alice@",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This field must be a valid email address",
+		},
+		{
+			name:     "Unknown email",
+			email:    "nobody@example.com",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:         "Known email",
+			email:        "alice@example.com",
+			wantCode:     http.StatusSeeOther,
+			wantMessages: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("email", tt.email)
+			form.Add("csrf_token", validCSRFToken)
+
+			code, header, body := ts.postForm(t, "/user/password/forgot", form)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.StringContains(t, body, tt.wantBody)
+			if code == http.StatusSeeOther {
+				assert.Equal(t, header.Get("Location"), "/user/login")
+			}
+
+			app.wg.Wait()
+			assert.Equal(t, len(mail.Messages()), tt.wantMessages)
+		})
+	}
+
+	msg := mail.Messages()[0]
+	assert.Equal(t, msg.Subject, "Reset your Snippetbox password")
+	assert.StringContains(t, msg.Body,
+		"https://snippets.example.com/user/password/reset?token="+mocks.MockResetToken)
+}
+
+func TestUserForgotPasswordLimit(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	mail := app.mailer.(*mailer.Memory)
+
+	_, _, body := ts.get(t, "/user/password/forgot")
+
+	form := url.Values{}
+	form.Add("email", "alice@example.com")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	for range resetEmailPolicy.LockAfter {
+		code, _, _ := ts.postForm(t, "/user/password/forgot", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+	}
+
+	t.Run("Same address", func(t *testing.T) {
+		form.Set("email", "Alice@Example.com")
+		code, _, body := ts.postForm(t, "/user/password/forgot", form)
+
+		assert.Equal(t, code, http.StatusTooManyRequests)
+		assert.StringContains(t, body, "Too many reset links have been asked for")
+
+		app.wg.Wait()
+		assert.Equal(t, len(mail.Messages()), resetEmailPolicy.LockAfter)
+	})
+
+	t.Run("Unknown address", func(t *testing.T) {
+		// Addresses without an account are limited the same way.
+		form.Set("email", "nobody@example.com")
+		for range resetEmailPolicy.LockAfter {
+			code, _, _ := ts.postForm(t, "/user/password/forgot", form)
+			assert.Equal(t, code, http.StatusSeeOther)
+		}
+
+		code, _, _ := ts.postForm(t, "/user/password/forgot", form)
+		assert.Equal(t, code, http.StatusTooManyRequests)
+	})
+
+	t.Run("Same client address", func(t *testing.T) {
+		sent := 2 * resetEmailPolicy.LockAfter
+		for i := sent; i < resetIPPolicy.LockAfter; i++ {
+			form.Set("email", fmt.Sprintf("user%d@example.com", i))
+			code, _, _ := ts.postForm(t, "/user/password/forgot", form)
+			assert.Equal(t, code, http.StatusSeeOther)
+		}
+
+		form.Set("email", "bob@example.com")
+		code, _, _ := ts.postForm(t, "/user/password/forgot", form)
+		assert.Equal(t, code, http.StatusTooManyRequests)
+	})
+}
+
+func TestUserResetPassword(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, header, _ := ts.get(t, "/user/password/reset?token=expired")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/user/password/forgot")
+
+	code, _, body := ts.get(t, "/user/password/reset?token="+mocks.MockResetToken)
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body,
+		`<input type="hidden" name="token" value="`+mocks.MockResetToken+`" />`)
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name         string
+		token        string
+		password     string
+		confirmation string
+		wantCode     int
+		wantLocation string
+		wantBody     string
+	}{
+		{
+			name:         "Short password",
+			token:        mocks.MockResetToken,
+			password:     "short",
+			confirmation: "short",
+			wantCode:     http.StatusUnprocessableEntity,
+			wantBody:     "New password must be at least 8 characters",
+		},
+		{
+			name:         "Mismatched confirmation",
+			token:        mocks.MockResetToken,
+			password:     "new pa$$word",
+			confirmation: "new password",
+			wantCode:     http.StatusUnprocessableEntity,
+			wantBody:     "Password is not match",
+		},
+		{
+			name:         "Invalid token",
+			token:        "expired",
+			password:     "new pa$$word",
+			confirmation: "new pa$$word",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/user/password/forgot",
+		},
+		{
+			name:         "Valid",
+			token:        mocks.MockResetToken,
+			password:     "new pa$$word",
+			confirmation: "new pa$$word",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/user/login",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("token", tt.token)
+			form.Add("newPassword", tt.password)
+			form.Add("confirmNewPassword", tt.confirmation)
+			form.Add("csrf_token", validCSRFToken)
+
+			code, header, body := ts.postForm(t, "/user/password/reset", form)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, header.Get("Location"), tt.wantLocation)
+			assert.StringContains(t, body, tt.wantBody)
+		})
+	}
 }
 
 func TestSnippetCreate(t *testing.T) {
@@ -204,6 +544,19 @@ func TestSnippetCreate(t *testing.T) {
 		assert.Equal(t, header.Get("Location"), "/user/login")
 	})
 
+	t.Run("Unverified email", func(t *testing.T) {
+		ts.login(t, "carol@example.com", "pa$$word")
+
+		code, header, _ := ts.get(t, "/snippet/create")
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/account/view")
+
+		_, _, body := ts.get(t, "/account/view")
+		assert.StringContains(t, body,
+			"Please verify your email address before creating snippets")
+	})
+
 	validCSRFToken := ""
 
 	t.Run("Authenticated", func(t *testing.T) {
@@ -219,20 +572,27 @@ func TestSnippetCreate(t *testing.T) {
 
 		code, _, body := ts.get(t, "/snippet/create")
 		assert.Equal(t, code, http.StatusOK)
-		assert.StringContains(t, body, `<form action="/snippet/create" method="POST">`)
+		assert.StringContains(t, body, `<form action="/snippet/create" method="POST" enctype="multipart/form-data">`)
+		assert.StringContains(t, body, `<label for="expires_at">On (UTC):</label>`)
 	})
 
 	const (
 		validTitle   = "Valid title"
 		validContent = "Valid content"
-		validExpires = "7"
+		validExpires = "7d"
 	)
 
 	tests := []struct {
 		name           string
 		snippetTitle   string
 		snippetContent string
+		snippetLang    string
+		snippetVis     string
+		snippetBurn    bool
+		snippetPass    string
+		snippetTags    string
 		snippetExpires string
+		snippetAt      string
 		csrfToken      string
 		wantCode       int
 		wantLocation   string
@@ -244,7 +604,7 @@ func TestSnippetCreate(t *testing.T) {
 			snippetExpires: validExpires,
 			csrfToken:      validCSRFToken,
 			wantCode:       http.StatusSeeOther,
-			wantLocation:   "/snippet/view",
+			wantLocation:   "/s/",
 		},
 		{
 			name:           "Invalid CSRF Token",
@@ -286,23 +646,1285 @@ func TestSnippetCreate(t *testing.T) {
 			csrfToken:      validCSRFToken,
 			wantCode:       http.StatusUnprocessableEntity,
 		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			form := url.Values{}
-			form.Add("title", tt.snippetTitle)
-			form.Add("content", tt.snippetContent)
-			form.Add("expires", tt.snippetExpires)
-			form.Add("csrf_token", validCSRFToken)
-
-			code, header, _ := ts.postForm(t, "/snippet/create", form)
-
-			assert.Equal(t, code, tt.wantCode)
-
-			if tt.wantLocation != "" {
-				assert.StringContains(t, header.Get("Location"), tt.wantLocation)
-			}
+		{
+			name:           "Valid language",
+			snippetTitle:   validTitle,
+			snippetContent: validContent,
+			snippetLang:    "go",
+			snippetExpires: validExpires,
+			csrfToken:      validCSRFToken,
+			wantCode:       http.StatusSeeOther,
+			wantLocation:   "/s/",
+		},
+		{
+			name:           "Invalid language",
+			snippetTitle:   validTitle,
+			snippetContent: validContent,
+			snippetLang:    "cobol",
+			snippetExpires: validExpires,
+			csrfToken:      validCSRFToken,
+			wantCode:       http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "Private",
+			snippetTitle:   validTitle,
+			snippetContent: validContent,
+			snippetVis:     "private",
+			snippetExpires: validExpires,
+			csrfToken:      validCSRFToken,
+			wantCode:       http.StatusSeeOther,
+			wantLocation:   "/s/",
+		},
+		{
+			name:           "Invalid visibility",
+			snippetTitle:   validTitle,
+			snippetContent: validContent,
+			snippetVis:     "secret",
+			snippetExpires: validExpires,
+			csrfToken:      validCSRFToken,
+			wantCode:       http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "Valid tags",
+			snippetTitle:   validTitle,
+			snippetContent: validContent,
+			snippetTags:    "go, http  Go",
+			snippetExpires: validExpires,
+			csrfToken:      validCSRFToken,
+			wantCode:       http.StatusSeeOther,
+			wantLocation:   "/s/",
+		},
+		{
+			name:           "Invalid tag",
+			snippetTitle:   validTitle,
+			snippetContent: validContent,
+			snippetTags:    "go, <script>",
+			snippetExpires: validExpires,
+			csrfToken:      validCSRFToken,
+			wantCode:       http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "Burn after reading",
+			snippetTitle:   validTitle,
+			snippetContent: validContent,
+			snippetVis:     "unlisted",
+			snippetBurn:    true,
+			snippetExpires: validExpires,
+			csrfToken:      validCSRFToken,
+			wantCode:       http.StatusSeeOther,
+			wantLocation:   "/s/",
+		},
+		{
+			name:           "Public burn after reading",
+			snippetTitle:   validTitle,
+			snippetContent: validContent,
+			snippetVis:     "public",
+			snippetBurn:    true,
+			snippetExpires: validExpires,
+			csrfToken:      validCSRFToken,
+			wantCode:       http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "Password",
+			snippetTitle:   validTitle,
+			snippetContent: validContent,
+			snippetPass:    "open sesame",
+			snippetExpires: validExpires,
+			csrfToken:      validCSRFToken,
+			wantCode:       http.StatusSeeOther,
+			wantLocation:   "/s/",
+		},
+		{
+			name:           "Short password",
+			snippetTitle:   validTitle,
+			snippetContent: validContent,
+			snippetPass:    "secret",
+			snippetExpires: validExpires,
+			csrfToken:      validCSRFToken,
+			wantCode:       http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "Ten minutes",
+			snippetTitle:   validTitle,
+			snippetContent: validContent,
+			snippetExpires: "10m",
+			csrfToken:      validCSRFToken,
+			wantCode:       http.StatusSeeOther,
+			wantLocation:   "/s/",
+		},
+		{
+			name:           "Never expires",
+			snippetTitle:   validTitle,
+			snippetContent: validContent,
+			snippetExpires: "never",
+			csrfToken:      validCSRFToken,
+			wantCode:       http.StatusSeeOther,
+			wantLocation:   "/s/",
+		},
+		{
+			name:           "Custom date",
+			snippetTitle:   validTitle,
+			snippetContent: validContent,
+			snippetExpires: "custom",
+			snippetAt:      time.Now().AddDate(0, 1, 0).UTC().Format("2006-01-02T15:04"),
+			csrfToken:      validCSRFToken,
+			wantCode:       http.StatusSeeOther,
+			wantLocation:   "/s/",
+		},
+		{
+			name:           "Past custom date",
+			snippetTitle:   validTitle,
+			snippetContent: validContent,
+			snippetExpires: "custom",
+			snippetAt:      "2020-01-01T00:00",
+			csrfToken:      validCSRFToken,
+			wantCode:       http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "Invalid custom date",
+			snippetTitle:   validTitle,
+			snippetContent: validContent,
+			snippetExpires: "custom",
+			snippetAt:      "tomorrow",
+			csrfToken:      validCSRFToken,
+			wantCode:       http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "Too many tags",
+			snippetTitle:   validTitle,
+			snippetContent: validContent,
+			snippetTags:    "a b c d e f",
+			snippetExpires: validExpires,
+			csrfToken:      validCSRFToken,
+			wantCode:       http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("title", tt.snippetTitle)
+			form.Add("content", tt.snippetContent)
+			form.Add("language", tt.snippetLang)
+			visibility := tt.snippetVis
+			if visibility == "" {
+				visibility = "public"
+			}
+			form.Add("visibility", visibility)
+			if tt.snippetBurn {
+				form.Add("burn", "true")
+			}
+			form.Add("password", tt.snippetPass)
+			form.Add("tags", tt.snippetTags)
+			form.Add("expires", tt.snippetExpires)
+			form.Add("expires_at", tt.snippetAt)
+			form.Add("csrf_token", validCSRFToken)
+
+			code, header, _ := ts.postForm(t, "/snippet/create", form)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantLocation != "" {
+				assert.StringContains(t, header.Get("Location"), tt.wantLocation)
+			}
+		})
+	}
+}
+
+func TestSnippetUpload(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "alice@example.com", "pa$$word")
+
+	_, _, body := ts.get(t, "/snippet/create")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name         string
+		fields       map[string]string
+		files        map[string]string
+		wantCode     int
+		wantLocation string
+		wantBody     []string
+	}{
+		{
+			name:         "Valid",
+			fields:       map[string]string{"expires": "7d"},
+			files:        map[string]string{"file": "package main\n"},
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/s/bmV3LXNuaXBw",
+		},
+		{
+			name:     "Infers title and language",
+			fields:   map[string]string{"expires": "forever"},
+			files:    map[string]string{"file": "package main\n"},
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: []string{
+				`<input type="text" id="title" name="title" value="main.go" />`,
+				`<option value="go" selected>Go</option>`,
+				"package main",
+			},
+		},
+		{
+			name: "Keeps given title and language",
+			fields: map[string]string{"expires": "forever", "title": "Entry point",
+				"language": "plaintext"},
+			files:    map[string]string{"file": "package main\n"},
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: []string{
+				`value="Entry point"`,
+				`<option value="plaintext" selected>Plain text</option>`,
+			},
+		},
+		{
+			name:     "Binary file",
+			fields:   map[string]string{"expires": "7d"},
+			files:    map[string]string{"file": "\x7fELF\x02\x01\x01\x00"},
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: []string{"This file must be UTF-8 text"},
+		},
+		{
+			name:     "Invalid UTF-8",
+			fields:   map[string]string{"expires": "7d"},
+			files:    map[string]string{"file": "caf\xe9"},
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: []string{"This file must be UTF-8 text"},
+		},
+		{
+			name:     "Too large",
+			fields:   map[string]string{"expires": "7d"},
+			files:    map[string]string{"file": strings.Repeat("a", maxContentBytes+1)},
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: []string{"This file cannot be larger than 64 KB"},
+		},
+		{
+			name:     "Body too large",
+			fields:   map[string]string{"expires": "7d"},
+			files:    map[string]string{"file": strings.Repeat("a", maxFormBytes)},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields := map[string]string{
+				"csrf_token": validCSRFToken,
+				"visibility": "public",
+			}
+			maps.Copy(fields, tt.fields)
+
+			body, contentType := multipartBody(t, fields, tt.files, "main.go")
+			code, header, rsBody := ts.request(t, http.MethodPost, "/snippet/create",
+				http.Header{"Content-Type": {contentType}}, body)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, header.Get("Location"), tt.wantLocation)
+			for _, want := range tt.wantBody {
+				assert.StringContains(t, rsBody, want)
+			}
+		})
+	}
+}
+
+func TestAccountView(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		code, header, _ := ts.get(t, "/account/view")
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/user/login")
+	})
+
+	t.Run("Lists own snippets", func(t *testing.T) {
+		ts.login(t, "alice@example.com", "pa$$word")
+
+		code, _, body := ts.get(t, "/account/view")
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "My snippets")
+		assert.StringContains(t, body, `<a href="/s/b2xkLXBvbmQx">An old silent pond</a>`)
+	})
+
+	t.Run("Lists API tokens", func(t *testing.T) {
+		_, _, body := ts.get(t, "/account/view")
+
+		assert.StringContains(t, body, "<td>Deploy script</td>")
+		assert.StringContains(t, body, "<td>read, write</td>")
+		assert.StringContains(t, body, `action="/account/tokens/revoke/1"`)
+	})
+}
+
+func TestTokenCreate(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "alice@example.com", "pa$$word")
+
+	_, _, body := ts.get(t, "/account/view")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		form     url.Values
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Blank name",
+			form:     url.Values{"name": {""}, "scopes": {"read"}},
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This field cannot be blank",
+		},
+		{
+			name:     "No scopes",
+			form:     url.Values{"name": {"CI"}},
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "Choose at least one scope",
+		},
+		{
+			name:     "Unknown scope",
+			form:     url.Values{"name": {"CI"}, "scopes": {"read", "admin"}},
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This field is invalid",
+		},
+		{
+			name:     "Valid",
+			form:     url.Values{"name": {"CI"}, "scopes": {"read", "write"}},
+			wantCode: http.StatusSeeOther,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.form.Add("csrf_token", validCSRFToken)
+
+			code, _, body := ts.postForm(t, "/account/tokens/create", tt.form)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.StringContains(t, body, tt.wantBody)
+		})
+	}
+
+	t.Run("Token is shown once", func(t *testing.T) {
+		_, _, body := ts.get(t, "/account/view")
+		assert.StringContains(t, body, `<code class="token">sb_bmV3LXRva2Vu</code>`)
+
+		_, _, body = ts.get(t, "/account/view")
+		assert.Equal(t, strings.Contains(body, "sb_bmV3LXRva2Vu"), false)
+	})
+}
+
+func TestTokenRevoke(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "bob@example.com", "pa$$word")
+
+	_, _, body := ts.get(t, "/account/view")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	// Bob can't revoke Alice's tokens.
+	form := url.Values{"csrf_token": {validCSRFToken}}
+	code, _, _ := ts.postForm(t, "/account/tokens/revoke/1", form)
+	assert.Equal(t, code, http.StatusNotFound)
+
+	ts.login(t, "alice@example.com", "pa$$word")
+
+	_, _, body = ts.get(t, "/account/view")
+	form = url.Values{"csrf_token": {extractCSRFToken(t, body)}}
+
+	code, header, _ := ts.postForm(t, "/account/tokens/revoke/1", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/account/view")
+}
+
+func TestSnippetEdit(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		code, header, _ := ts.get(t, "/snippet/edit/1")
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/user/login")
+	})
+
+	ts.login(t, "alice@example.com", "pa$$word")
+
+	_, _, body := ts.get(t, "/snippet/edit/1")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	getTests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Owner",
+			urlPath:  "/snippet/edit/1",
+			wantCode: http.StatusOK,
+			wantBody: `<form action="/snippet/edit/1" method="POST">`,
+		},
+		{
+			name:     "Not owner",
+			urlPath:  "/snippet/edit/3",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Non-existent ID",
+			urlPath:  "/snippet/edit/2",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "String ID",
+			urlPath:  "/snippet/edit/foo",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range getTests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+
+	postTests := []struct {
+		name         string
+		urlPath      string
+		title        string
+		wantCode     int
+		wantLocation string
+	}{
+		{
+			name:         "Valid submission",
+			urlPath:      "/snippet/edit/1",
+			title:        "Updated title",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/s/b2xkLXBvbmQx",
+		},
+		{
+			name:     "Title blank",
+			urlPath:  "/snippet/edit/1",
+			title:    "",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Not owner",
+			urlPath:  "/snippet/edit/3",
+			title:    "Updated title",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range postTests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("title", tt.title)
+			form.Add("content", "Updated content")
+			form.Add("visibility", "public")
+			form.Add("expires", "7d")
+			form.Add("csrf_token", validCSRFToken)
+
+			code, header, _ := ts.postForm(t, tt.urlPath, form)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantLocation != "" {
+				assert.Equal(t, header.Get("Location"), tt.wantLocation)
+			}
+		})
+	}
+}
+
+func TestSnippetDelete(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "alice@example.com", "pa$$word")
+
+	_, _, body := ts.get(t, "/s/b2xkLXBvbmQx")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		csrfToken    string
+		wantCode     int
+		wantLocation string
+	}{
+		{
+			name:         "Owner",
+			urlPath:      "/snippet/delete/1",
+			csrfToken:    validCSRFToken,
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/account/trash",
+		},
+		{
+			name:      "Invalid CSRF Token",
+			urlPath:   "/snippet/delete/1",
+			csrfToken: "wrongToken",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "Not owner",
+			urlPath:   "/snippet/delete/3",
+			csrfToken: validCSRFToken,
+			wantCode:  http.StatusNotFound,
+		},
+		{
+			name:      "Non-existent ID",
+			urlPath:   "/snippet/delete/2",
+			csrfToken: validCSRFToken,
+			wantCode:  http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", tt.csrfToken)
+
+			code, header, _ := ts.postForm(t, tt.urlPath, form)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantLocation != "" {
+				assert.Equal(t, header.Get("Location"), tt.wantLocation)
+			}
+		})
+	}
+}
+
+func TestTrash(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		code, header, _ := ts.get(t, "/account/trash")
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/user/login")
+	})
+
+	ts.login(t, "alice@example.com", "pa$$word")
+
+	code, _, body := ts.get(t, "/account/trash")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "First autumn morning")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+	}{
+		{
+			name:     "Restore",
+			urlPath:  "/account/trash/restore/4",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Restore snippet not in trash",
+			urlPath:  "/account/trash/restore/1",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Purge",
+			urlPath:  "/account/trash/purge/4",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Purge snippet not in trash",
+			urlPath:  "/account/trash/purge/1",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", validCSRFToken)
+
+			code, _, _ := ts.postForm(t, tt.urlPath, form)
+
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestSnippetHistory(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "History",
+			urlPath:  "/s/b2xkLXBvbmQx/history",
+			wantCode: http.StatusOK,
+			wantBody: `<form action="/s/b2xkLXBvbmQx/diff" method="GET">`,
+		},
+		{
+			name:     "History title",
+			urlPath:  "/s/b2xkLXBvbmQx/history",
+			wantCode: http.StatusOK,
+			wantBody: "<title>History of An old silent pond - Snippetbox</title>",
+		},
+		{
+			name:     "History of non-existent snippet",
+			urlPath:  "/s/doesnotexist/history",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Diff",
+			urlPath:  "/s/b2xkLXBvbmQx/diff?from=1&to=2",
+			wantCode: http.StatusOK,
+			wantBody: `<span class="diff-insert">&#43;A frog jumps into the pond,</span>`,
+		},
+		{
+			name:     "Diff hunk header",
+			urlPath:  "/s/b2xkLXBvbmQx/diff?from=1&to=2",
+			wantCode: http.StatusOK,
+			wantBody: "@@ -1,1 &#43;1,2 @@",
+		},
+		{
+			name:     "Diff title",
+			urlPath:  "/s/b2xkLXBvbmQx/diff?from=1&to=2",
+			wantCode: http.StatusOK,
+			wantBody: "<title>Changes to An old silent pond - Snippetbox</title>",
+		},
+		{
+			name:     "Diff with non-existent revision",
+			urlPath:  "/s/b2xkLXBvbmQx/diff?from=1&to=9",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Diff with missing revision",
+			urlPath:  "/s/b2xkLXBvbmQx/diff?from=1",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSnippetBrowse(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	cursor := models.NewCursor(&models.Snippet{Id: 1, Created: time.Now()}).String()
+
+	tests := []struct {
+		name       string
+		urlPath    string
+		wantCode   int
+		wantBody   string
+		unwantBody string
+	}{
+		{
+			name:       "First page",
+			urlPath:    "/snippets",
+			wantCode:   http.StatusOK,
+			wantBody:   `class="next">Next`,
+			unwantBody: `class="prev"`,
+		},
+		{
+			name:       "Last page",
+			urlPath:    "/snippets?after=" + cursor,
+			wantCode:   http.StatusOK,
+			wantBody:   `class="prev">`,
+			unwantBody: `class="next"`,
+		},
+		{
+			name:     "Invalid cursor",
+			urlPath:  "/snippets?after=foo",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+			if tt.unwantBody != "" && strings.Contains(body, tt.unwantBody) {
+				t.Errorf("got: %q; expected not to contain: %q", body, tt.unwantBody)
+			}
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "No query",
+			urlPath:  "/search",
+			wantCode: http.StatusOK,
+			wantBody: "Enter some words",
+		},
+		{
+			name:     "Match",
+			urlPath:  "/search?q=pond",
+			wantCode: http.StatusOK,
+			wantBody: "An old silent <mark>pond</mark>",
+		},
+		{
+			name:     "No match",
+			urlPath:  "/search?q=frog",
+			wantCode: http.StatusOK,
+			wantBody: "No snippets match your search.",
+		},
+		{
+			name:     "Query kept in search box",
+			urlPath:  "/search?q=pond",
+			wantCode: http.StatusOK,
+			wantBody: `name="q" value="pond"`,
+		},
+		{
+			name:     "Invalid page",
+			urlPath:  "/search?q=pond&page=0",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestTagView(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Tag with snippets",
+			urlPath:  "/tag/poetry",
+			wantCode: http.StatusOK,
+			wantBody: `<a href="/s/b2xkLXBvbmQx">An old silent pond</a>`,
+		},
+		{
+			name:     "Unused tag",
+			urlPath:  "/tag/go",
+			wantCode: http.StatusOK,
+			wantBody: "There are no snippets with this tag.",
+		},
+		{
+			name:     "Invalid tag",
+			urlPath:  "/tag/NOT%20A%20TAG",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Tag cloud on home page",
+			urlPath:  "/",
+			wantCode: http.StatusOK,
+			wantBody: `<a href="/tag/poetry" class="tag size-5">poetry</a>`,
+		},
+		{
+			name:     "Tags on snippet",
+			urlPath:  "/s/b2xkLXBvbmQx",
+			wantCode: http.StatusOK,
+			wantBody: `<a href="/tag/poetry" class="tag">poetry</a>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSnippetRaw(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name            string
+		urlPath         string
+		wantCode        int
+		wantBody        string
+		wantDisposition string
+	}{
+		{
+			name:     "Raw",
+			urlPath:  "/s/b2xkLXBvbmQx/raw",
+			wantCode: http.StatusOK,
+			wantBody: "An old silent pond...",
+		},
+		{
+			name:     "Raw non-existent ID",
+			urlPath:  "/s/doesnotexist/raw",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:            "Download",
+			urlPath:         "/s/b2xkLXBvbmQx/download",
+			wantCode:        http.StatusOK,
+			wantBody:        "An old silent pond...",
+			wantDisposition: `attachment; filename=an-old-silent-pond.txt`,
+		},
+		{
+			name:     "Download non-existent ID",
+			urlPath:  "/s/doesnotexist/download",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.Equal(t, body, tt.wantBody)
+				assert.Equal(t, header.Get("Content-Type"), "text/plain; charset=utf-8")
+			}
+			if tt.wantDisposition != "" {
+				assert.Equal(t, header.Get("Content-Disposition"), tt.wantDisposition)
+			}
+		})
+	}
+}
+
+func TestSnippetFilename(t *testing.T) {
+	tests := []struct {
+		name    string
+		snippet *models.Snippet
+		want    string
+	}{
+		{
+			name:    "Language extension",
+			snippet: &models.Snippet{Id: 1, Title: "Hello, World!", Language: "go"},
+			want:    "hello-world.go",
+		},
+		{
+			name:    "Auto-detected language",
+			snippet: &models.Snippet{Id: 1, Title: "notes", Language: ""},
+			want:    "notes.txt",
+		},
+		{
+			name:    "No usable title characters",
+			snippet: &models.Snippet{Id: 7, Title: "日本語", Language: "python"},
+			want:    "snippet-7.py",
+		},
+		{
+			name:    "Path separators",
+			snippet: &models.Snippet{Id: 1, Title: "../../etc/passwd", Language: "bash"},
+			want:    "etc-passwd.sh",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, snippetFilename(tt.snippet), tt.want)
+		})
+	}
+}
+
+func TestSnippetVisibility(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name     string
+		email    string
+		urlPath  string
+		wantCode int
+	}{
+		{"Anonymous views public", "", "/s/b2xkLXBvbmQx", http.StatusOK},
+		{"Anonymous views unlisted", "", "/s/dW5saXN0ZWQ2", http.StatusOK},
+		{"Anonymous views private", "", "/s/cHJpdmF0ZS01", http.StatusNotFound},
+		{"Anonymous downloads private", "", "/s/cHJpdmF0ZS01/raw", http.StatusNotFound},
+		{"Anonymous views private history", "", "/s/cHJpdmF0ZS01/history", http.StatusNotFound},
+		{"Owner views public", "alice@example.com", "/s/b2xkLXBvbmQx", http.StatusOK},
+		{"Owner views unlisted", "alice@example.com", "/s/dW5saXN0ZWQ2", http.StatusOK},
+		{"Owner views private", "alice@example.com", "/s/cHJpdmF0ZS01", http.StatusOK},
+		{"Owner downloads private", "alice@example.com", "/s/cHJpdmF0ZS01/raw", http.StatusOK},
+		{"Other user views public", "bob@example.com", "/s/b2xkLXBvbmQx", http.StatusOK},
+		{"Other user views unlisted", "bob@example.com", "/s/dW5saXN0ZWQ2", http.StatusOK},
+		{"Other user views private", "bob@example.com", "/s/cHJpdmF0ZS01", http.StatusNotFound},
+		{"Other user edits private", "bob@example.com", "/snippet/edit/5", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			if tt.email != "" {
+				ts.login(t, tt.email, "pa$$word")
+			}
+
+			code, _, _ := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestSnippetRedirect(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name         string
+		email        string
+		urlPath      string
+		wantCode     int
+		wantLocation string
+	}{
+		{
+			name:         "Public snippet",
+			urlPath:      "/snippet/view/1",
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "/s/b2xkLXBvbmQx",
+		},
+		{
+			name:         "Raw content",
+			urlPath:      "/snippet/raw/1",
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "/s/b2xkLXBvbmQx/raw",
+		},
+		{
+			name:         "Keeps query",
+			urlPath:      "/snippet/view/1/diff?from=1&to=2",
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "/s/b2xkLXBvbmQx/diff?from=1&to=2",
+		},
+		{
+			name:     "Unlisted snippet",
+			urlPath:  "/snippet/view/6",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Private snippet",
+			urlPath:  "/snippet/view/5",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:         "Own unlisted snippet",
+			email:        "alice@example.com",
+			urlPath:      "/snippet/view/6",
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "/s/dW5saXN0ZWQ2",
+		},
+		{
+			name:     "Other user's unlisted snippet",
+			email:    "bob@example.com",
+			urlPath:  "/snippet/view/6",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			if tt.email != "" {
+				ts.login(t, tt.email, "pa$$word")
+			}
+
+			code, header, _ := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, header.Get("Location"), tt.wantLocation)
+		})
+	}
+}
+
+func TestSnippetBurn(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	const burnPath = "/s/YnVybi1hZnRl"
+
+	t.Run("Confirmation page", func(t *testing.T) {
+		code, _, body := ts.get(t, burnPath)
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "Reveal snippet")
+		assert.Equal(t, strings.Contains(body, "hunter2"), false)
+	})
+
+	for _, suffix := range []string{"/raw", "/download", "/history"} {
+		t.Run("No "+suffix, func(t *testing.T) {
+			code, _, _ := ts.get(t, burnPath+suffix)
+
+			assert.Equal(t, code, http.StatusNotFound)
+		})
+	}
+
+	_, _, body := ts.get(t, burnPath)
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name      string
+		urlPath   string
+		csrfToken string
+		wantCode  int
+		wantBody  string
+	}{
+		{
+			name:      "Reveal",
+			urlPath:   burnPath,
+			csrfToken: validCSRFToken,
+			wantCode:  http.StatusOK,
+			wantBody:  "hunter2",
+		},
+		{
+			name:      "Invalid CSRF token",
+			urlPath:   burnPath,
+			csrfToken: "wrongToken",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "Not burn after reading",
+			urlPath:   "/s/b2xkLXBvbmQx",
+			csrfToken: validCSRFToken,
+			wantCode:  http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", tt.csrfToken)
+
+			code, header, body := ts.postForm(t, tt.urlPath, form)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+				assert.Equal(t, header.Get("Cache-Control"), "no-store")
+			}
+		})
+	}
+}
+
+func TestSnippetUnlock(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	const protectedPath = "/s/cHJvdGVjdGVk"
+	const content = "Only people with the password can read this"
+
+	code, _, body := ts.get(t, protectedPath)
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "Enter its password")
+	assert.Equal(t, strings.Contains(body, content), false)
+
+	code, _, _ = ts.get(t, protectedPath+"/raw")
+	assert.Equal(t, code, http.StatusForbidden)
+
+	validCSRFToken := extractCSRFToken(t, body)
+
+	form := url.Values{}
+	form.Add("password", "wrong")
+	form.Add("csrf_token", validCSRFToken)
+	code, _, body = ts.postForm(t, protectedPath+"/unlock", form)
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+	assert.StringContains(t, body, "Password is incorrect")
+
+	form.Set("password", "open sesame")
+	code, header, _ := ts.postForm(t, protectedPath+"/unlock", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), protectedPath)
+
+	code, _, body = ts.get(t, protectedPath)
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, content)
+
+	code, _, body = ts.get(t, protectedPath+"/raw")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, body, content)
+}
+
+func TestSnippetUnlockOwner(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "alice@example.com", "pa$$word")
+
+	code, _, body := ts.get(t, "/s/cHJvdGVjdGVk")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "Only people with the password can read this")
+}
+
+func TestSnippetUnlockRateLimit(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/s/cHJvdGVjdGVk")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	form := url.Values{}
+	form.Add("password", "wrong")
+	form.Add("csrf_token", validCSRFToken)
+
+	for range 5 {
+		code, _, _ := ts.postForm(t, "/s/cHJvdGVjdGVk/unlock", form)
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+	}
+
+	form.Set("password", "open sesame")
+	code, _, body := ts.postForm(t, "/s/cHJvdGVjdGVk/unlock", form)
+	assert.Equal(t, code, http.StatusTooManyRequests)
+	assert.StringContains(t, body, "Too many incorrect passwords")
+}
+
+func TestSnippetUnlockConcurrent(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/s/cHJvdGVjdGVk")
+
+	form := url.Values{}
+	form.Add("password", "wrong")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	// Guesses made all at once must not get past the limit.
+	codes := make(chan int, 20)
+	var wg sync.WaitGroup
+	for range cap(codes) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			code, _, _ := ts.postForm(t, "/s/cHJvdGVjdGVk/unlock", form)
+			codes <- code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	checked := 0
+	for code := range codes {
+		if code == http.StatusUnprocessableEntity {
+			checked++
+		}
+	}
+	assert.Equal(t, checked, snippetUnlockPolicy.LockAfter)
+}
+
+func TestSnippetFormExpiry(t *testing.T) {
+	now := time.Date(2024, 3, 17, 10, 15, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		expires   string
+		expiresAt string
+		want      time.Time
+	}{
+		{"Ten minutes", "10m", "", now.Add(10 * time.Minute)},
+		{"One year", "365d", "", now.AddDate(1, 0, 0)},
+		{"Never", "never", "", time.Time{}},
+		{"Custom", "custom", "2024-04-01T09:30",
+			time.Date(2024, 4, 1, 9, 30, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := snippetCreateForm{Expires: tt.expires, ExpiresAt: tt.expiresAt}
+
+			assert.Equal(t, form.expiry(now), tt.want)
+		})
+	}
+}
+
+func TestSnippetFormEditExpiry(t *testing.T) {
+	now := time.Date(2024, 3, 17, 10, 15, 0, 0, time.UTC)
+	snippet := &models.Snippet{Expires: time.Date(2024, 4, 1, 9, 30, 45, 0, time.UTC)}
+
+	tests := []struct {
+		name      string
+		expires   string
+		expiresAt string
+		want      time.Time
+	}{
+		{"Unchanged", "custom", "2024-04-01T09:30", snippet.Expires},
+		{"Changed", "custom", "2024-04-01T09:31",
+			time.Date(2024, 4, 1, 9, 31, 0, 0, time.UTC)},
+		{"Relative", "1h", "2024-04-01T09:30", now.Add(time.Hour)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := snippetCreateForm{Expires: tt.expires, ExpiresAt: tt.expiresAt}
+
+			assert.Equal(t, form.editExpiry(snippet, now), tt.want)
 		})
 	}
 }
@@ -4,11 +4,17 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"mime"
+	"net"
 	"net/http"
 	"runtime/debug"
+	"slices"
+	"strconv"
+	"thienel/lets-go/internal/models"
 	"time"
 
 	"github.com/go-playground/form/v4"
+	"github.com/julienschmidt/httprouter"
 	"github.com/justinas/nosurf"
 )
 
@@ -23,6 +29,28 @@ func (app *application) serverError(w http.ResponseWriter, err error) {
 		http.StatusInternalServerError)
 }
 
+// background runs fn in its own goroutine, logging any error or panic.
+// It is used for slow work, such as sending email, that the response
+// shouldn't wait for, or give away by taking longer.
+func (app *application) background(fn func() error) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.errorLog.Print(fmt.Errorf("%s\n%s", err, debug.Stack()))
+			}
+		}()
+
+		err := fn()
+		if err != nil {
+			app.errorLog.Print(err)
+		}
+	}()
+}
+
 func (app *application) clientError(w http.ResponseWriter, status int) {
 	http.Error(w, http.StatusText(status), status)
 }
@@ -54,15 +82,24 @@ func (app *application) render(w http.ResponseWriter, status int,
 
 func (app *application) newTemplateData(r *http.Request) *templateData {
 	return &templateData{
-		CurrentYear:     time.Now().Year(),
-		Flash:           app.sessionManager.PopString(r.Context(), "flash"),
-		IsAuthenticated: app.isAuthenticated(r),
-		CSRFToken:       nosurf.Token(r),
+		CurrentYear:         time.Now().Year(),
+		Flash:               app.sessionManager.PopString(r.Context(), "flash"),
+		IsAuthenticated:     app.isAuthenticated(r),
+		AuthenticatedUserID: app.authenticatedUserID(r),
+		CSRFToken:           nosurf.Token(r),
 	}
 }
 
+// decodePostForm decodes the urlencoded or multipart form in the request
+// body into dst. Uploaded files are left in r.MultipartForm.
 func (app *application) decodePostForm(r *http.Request, dst any) error {
-	err := r.ParseForm()
+	var err error
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		err = r.ParseMultipartForm(maxFormBytes)
+	} else {
+		err = r.ParseForm()
+	}
 	if err != nil {
 		return err
 	}
@@ -81,6 +118,145 @@ func (app *application) decodePostForm(r *http.Request, dst any) error {
 	return nil
 }
 
+// readIDParam returns the positive integer :id route parameter of r.
+func readIDParam(r *http.Request) (int, bool) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		return 0, false
+	}
+
+	return id, true
+}
+
+// viewableSnippet looks up the snippet named by the :slug route parameter
+// and checks the current user may see it. If it can't be shown, an error
+// response has already been written and ok is false.
+func (app *application) viewableSnippet(w http.ResponseWriter,
+	r *http.Request) (snippet *models.Snippet, ok bool) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	snippet, ok = app.lookupSnippet(w, func() (*models.Snippet, error) {
+		return app.snippets.GetBySlug(params.ByName("slug"))
+	})
+	if !ok {
+		return nil, false
+	}
+
+	// Private snippets are reported as missing rather than forbidden so
+	// their existence isn't revealed.
+	if snippet.Visibility == models.VisibilityPrivate &&
+		snippet.UserId != app.authenticatedUserID(r) {
+		app.notFound(w)
+		return nil, false
+	}
+
+	return snippet, true
+}
+
+// readableSnippet is like viewableSnippet but also refuses
+// burn-after-reading snippets, whose content may only be read through the
+// confirmation page, and password-protected snippets that haven't been
+// unlocked.
+func (app *application) readableSnippet(w http.ResponseWriter,
+	r *http.Request) (snippet *models.Snippet, ok bool) {
+	snippet, ok = app.viewableSnippet(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	if snippet.BurnAfterReading {
+		app.notFound(w)
+		return nil, false
+	}
+
+	if !app.isUnlocked(r, snippet) {
+		app.clientError(w, http.StatusForbidden)
+		return nil, false
+	}
+
+	return snippet, true
+}
+
+// isUnlocked reports whether the current user may read the snippet's
+// content: it isn't password-protected, it is their own or they have
+// entered its password during this session.
+func (app *application) isUnlocked(r *http.Request, snippet *models.Snippet) bool {
+	if !snippet.Protected || snippet.UserId == app.authenticatedUserID(r) {
+		return true
+	}
+
+	unlocked, _ := app.sessionManager.Get(r.Context(), "unlockedSnippets").([]int)
+
+	return slices.Contains(unlocked, snippet.Id)
+}
+
+// ownedSnippet looks up the snippet named by the :id route parameter and
+// checks that it belongs to the authenticated user. Other users' snippets
+// are not found, whatever their visibility, so that the response doesn't
+// show which ids belong to private snippets.
+func (app *application) ownedSnippet(w http.ResponseWriter,
+	r *http.Request) (snippet *models.Snippet, ok bool) {
+	snippet, ok = app.snippetByID(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	if snippet.UserId != app.authenticatedUserID(r) {
+		app.notFound(w)
+		return nil, false
+	}
+
+	return snippet, true
+}
+
+func (app *application) snippetByID(w http.ResponseWriter,
+	r *http.Request) (*models.Snippet, bool) {
+	id, ok := readIDParam(r)
+	if !ok {
+		app.notFound(w)
+		return nil, false
+	}
+
+	return app.lookupSnippet(w, func() (*models.Snippet, error) {
+		return app.snippets.Get(id)
+	})
+}
+
+// lookupSnippet runs get, writing a 404 or 500 response if it fails.
+func (app *application) lookupSnippet(w http.ResponseWriter,
+	get func() (*models.Snippet, error)) (*models.Snippet, bool) {
+	snippet, err := get()
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return nil, false
+	}
+
+	return snippet, true
+}
+
+// snippetURL returns the canonical path of a snippet page, e.g. "/s/abc"
+// or, with a suffix, "/s/abc/raw".
+func snippetURL(slug string, suffix string) string {
+	return "/s/" + slug + suffix
+}
+
+func (app *application) authenticatedUserID(r *http.Request) int {
+	if !app.isAuthenticated(r) {
+		return 0
+	}
+
+	if token := apiToken(r); token != nil {
+		return token.UserId
+	}
+
+	return app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+}
+
 func (app *application) isAuthenticated(r *http.Request) bool {
 	isAuthenticated, ok := r.Context().Value(isAuthenticatedContextKey).(bool)
 	if !ok {
@@ -89,3 +265,32 @@ func (app *application) isAuthenticated(r *http.Request) bool {
 
 	return isAuthenticated
 }
+
+// apiToken returns the personal access token the request was authenticated
+// with, if any.
+func apiToken(r *http.Request) *models.Token {
+	token, _ := r.Context().Value(apiTokenContextKey).(*models.Token)
+	return token
+}
+
+// emailVerified reports whether the authenticated user has verified their
+// email address. Until they have, they can't create snippets.
+func (app *application) emailVerified(r *http.Request) (bool, error) {
+	user, err := app.users.Get(app.authenticatedUserID(r))
+	if err != nil {
+		return false, err
+	}
+
+	return user.EmailVerified, nil
+}
+
+// clientIP returns the address the request came from. The server isn't run
+// behind a proxy, so headers such as X-Forwarded-For aren't trusted.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
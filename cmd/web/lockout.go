@@ -0,0 +1,276 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"thienel/lets-go/internal/lockout"
+	"thienel/lets-go/internal/models"
+	"time"
+)
+
+// accountLoginPolicy slows down password guessing against one account. After
+// three wrong passwords each attempt waits twice as long as the last, and
+// after ten the account is locked until the owner unlocks it by email or
+// the lock runs out.
+var accountLoginPolicy = lockout.Policy{
+	Free:      3,
+	BaseDelay: time.Second,
+	MaxDelay:  time.Minute,
+	LockAfter: 10,
+	LockFor:   15 * time.Minute,
+}
+
+// ipLoginPolicy does the same for guessing from one address across many
+// accounts. It is looser, since many users can share an address.
+var ipLoginPolicy = lockout.Policy{
+	Free:      20,
+	BaseDelay: time.Second,
+	MaxDelay:  time.Minute,
+	LockAfter: 100,
+	LockFor:   15 * time.Minute,
+}
+
+// accountUnlockTTL is how long an emailed unlock link works for.
+const accountUnlockTTL = time.Hour
+
+func accountLoginKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipLoginKey(ip string) string {
+	return "ip:" + ip
+}
+
+// humanWait formats a wait for login error messages, rounded up to a whole
+// second or minute.
+func humanWait(d time.Duration) string {
+	if d <= time.Minute {
+		s := int((d + time.Second - 1) / time.Second)
+		if s == 1 {
+			return "1 second"
+		}
+		return fmt.Sprintf("%d seconds", s)
+	}
+
+	m := int((d + time.Minute - 1) / time.Minute)
+	return fmt.Sprintf("%d minutes", m)
+}
+
+// blockedMessage returns the error to show for a login attempt refused
+// with the given statuses. The messages are the same whether or not the
+// address has an account.
+func blockedMessage(ipStatus, accountStatus lockout.Status) string {
+	if ipStatus.Locked {
+		return fmt.Sprintf("Too many failed logins from your network. Please try again in %s",
+			humanWait(ipStatus.Wait))
+	}
+
+	if accountStatus.Locked {
+		return fmt.Sprintf("This account is locked after too many failed logins. "+
+			"Please try again in %s, or use the unlock link we've emailed to it",
+			humanWait(accountStatus.Wait))
+	}
+
+	wait := max(ipStatus.Wait, accountStatus.Wait)
+	if wait > 0 {
+		return fmt.Sprintf("Too many failed logins. Please wait %s before trying again",
+			humanWait(wait))
+	}
+
+	return ""
+}
+
+// loginBlocked returns the error to show if a login for email can't be
+// attempted from this request's address right now, or "" if it can.
+func (app *application) loginBlocked(r *http.Request, email string) (string, error) {
+	ipStatus, err := app.ipGuard.Check(ipLoginKey(clientIP(r)))
+	if err != nil {
+		return "", err
+	}
+
+	accountStatus, err := app.accountGuard.Check(accountLoginKey(email))
+	if err != nil {
+		return "", err
+	}
+
+	return blockedMessage(ipStatus, accountStatus), nil
+}
+
+// loginAttempt is a login reserved by reserveLogin, on the address and on
+// the account.
+type loginAttempt struct {
+	ip      lockout.Reservation
+	account lockout.Reservation
+}
+
+// reserveLogin counts a login for email from this request's address as
+// failed before the password is checked, so that parallel guesses can't all
+// get past the backoff. It returns the error to show if the login can't be
+// attempted right now, in which case nothing is counted. Otherwise the
+// attempt must be settled with loginSucceeded, loginFailed or
+// loginAborted.
+func (app *application) reserveLogin(r *http.Request, email string) (loginAttempt, string, error) {
+	var attempt loginAttempt
+	ipKey := ipLoginKey(clientIP(r))
+
+	ipRes, err := app.ipGuard.Reserve(ipKey)
+	if err != nil {
+		return attempt, "", err
+	}
+	if !ipRes.Allowed() {
+		return attempt, blockedMessage(ipRes.Status, lockout.Status{}), nil
+	}
+
+	accountRes, err := app.accountGuard.Reserve(accountLoginKey(email))
+	if err != nil {
+		return attempt, "", err
+	}
+	if !accountRes.Allowed() {
+		// The address only pays for attempts that were made.
+		err = app.ipGuard.Release(ipKey, ipRes)
+		if err != nil {
+			return attempt, "", err
+		}
+		return attempt, blockedMessage(lockout.Status{}, accountRes.Status), nil
+	}
+
+	return loginAttempt{ip: ipRes, account: accountRes}, "", nil
+}
+
+// loginSucceeded takes back a reserved login that had the right password.
+// The account's earlier failures are forgotten, but not the address's,
+// since it may be guessing at other accounts too.
+func (app *application) loginSucceeded(r *http.Request, email string, attempt loginAttempt) error {
+	err := app.ipGuard.Release(ipLoginKey(clientIP(r)), attempt.ip)
+	if err != nil {
+		return err
+	}
+
+	return app.accountGuard.Reset(accountLoginKey(email))
+}
+
+// loginAborted takes back a reserved login for email whose password
+// couldn't be checked, e.g. because the database failed, so that errors
+// don't count against the address or the account.
+func (app *application) loginAborted(r *http.Request, email string, attempt loginAttempt) error {
+	err := app.ipGuard.Release(ipLoginKey(clientIP(r)), attempt.ip)
+	if err != nil {
+		return err
+	}
+
+	return app.accountGuard.Release(accountLoginKey(email), attempt.account)
+}
+
+// loginFailed acts on a reserved login for email that had a wrong password.
+// Lockouts it caused are written to the audit log, and the owner of a locked
+// account is emailed a link to unlock it.
+func (app *application) loginFailed(r *http.Request, email string, attempt loginAttempt) error {
+	ip := clientIP(r)
+
+	if attempt.ip.Locked {
+		err := app.audit.Insert(&models.AuditEntry{
+			Event:  models.AuditIPLocked,
+			IP:     ip,
+			Detail: fmt.Sprintf("locked for %s", ipLoginPolicy.LockFor),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if !attempt.account.Locked {
+		return nil
+	}
+
+	// Addresses without an account are locked too, so that lockouts don't
+	// reveal who has signed up, but there is no one to tell.
+	user, err := app.users.GetByEmail(email)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		return err
+	}
+
+	entry := &models.AuditEntry{
+		Event:  models.AuditAccountLocked,
+		IP:     ip,
+		Detail: email,
+	}
+	if user != nil {
+		entry.UserId = user.Id
+	}
+
+	err = app.audit.Insert(entry)
+	if err != nil {
+		return err
+	}
+
+	if user != nil {
+		// The link is sent in the background, so that how long the response
+		// takes doesn't show whether the address has an account. The lock
+		// runs out by itself, so a failure to send it is only logged.
+		app.background(func() error {
+			return app.sendAccountUnlock(user)
+		})
+	}
+
+	return nil
+}
+
+func (app *application) sendAccountUnlock(user *models.User) error {
+	token, err := app.accountUnlocks.Insert(user.Id, accountUnlockTTL)
+	if err != nil {
+		return err
+	}
+
+	return app.mailer.Send(user.Email, "account_unlock.tmpl", map[string]any{
+		"Name":     user.Name,
+		"URL":      app.baseURL + "/user/unlock?token=" + url.QueryEscape(token),
+		"TTL":      "an hour",
+		"Attempts": accountLoginPolicy.LockAfter,
+		"LockFor":  humanWait(accountLoginPolicy.LockFor),
+	})
+}
+
+func (app *application) userUnlock(w http.ResponseWriter, r *http.Request) {
+	userId, err := app.accountUnlocks.Consume(r.URL.Query().Get("token"))
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			app.sessionManager.Put(r.Context(), "flash",
+				"That unlock link is invalid or has expired")
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	user, err := app.users.Get(userId)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.accountGuard.Reset(accountLoginKey(user.Email))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.audit.Insert(&models.AuditEntry{
+		UserId: user.Id,
+		Event:  models.AuditAccountUnlocked,
+		IP:     clientIP(r),
+		Detail: user.Email,
+	})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash",
+		"Your account has been unlocked. Please log in")
+
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"thienel/lets-go/internal/assert"
+	"thienel/lets-go/internal/lockout"
+	"thienel/lets-go/internal/mailer"
+	"thienel/lets-go/internal/models"
+	"thienel/lets-go/internal/models/mocks"
+	"time"
+)
+
+func TestHumanWait(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{300 * time.Millisecond, "1 second"},
+		{time.Second, "1 second"},
+		{1500 * time.Millisecond, "2 seconds"},
+		{time.Minute, "60 seconds"},
+		{61 * time.Second, "2 minutes"},
+		{15 * time.Minute, "15 minutes"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, humanWait(tt.d), tt.want)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	app := newTestApplication(t)
+
+	// Share the store with the test, so that it can skip ahead to just
+	// before a lockout.
+	store := &lockout.Memory{}
+	app.accountGuard = lockout.New(store, accountLoginPolicy)
+	app.ipGuard = lockout.New(store, ipLoginPolicy)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	mail := app.mailer.(*mailer.Memory)
+	audit := app.audit.(*mocks.AuditModel)
+
+	_, _, body := ts.get(t, "/user/login")
+	csrfToken := extractCSRFToken(t, body)
+
+	login := func(t *testing.T, email, password string) (int, string) {
+		form := url.Values{}
+		form.Add("email", email)
+		form.Add("password", password)
+		form.Add("csrf_token", csrfToken)
+
+		code, _, body := ts.postForm(t, "/user/login", form)
+		return code, body
+	}
+
+	nearlyLocked := lockout.Record{
+		Failures:    accountLoginPolicy.LockAfter - 1,
+		LastFailure: time.Now().Add(-2 * time.Minute),
+	}
+
+	t.Run("Backoff", func(t *testing.T) {
+		for range accountLoginPolicy.Free {
+			code, body := login(t, "bob@example.com", "wrong")
+			assert.Equal(t, code, http.StatusUnprocessableEntity)
+			assert.StringContains(t, body, "Email or password is incorrect")
+		}
+
+		code, body := login(t, "bob@example.com", "wrong")
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+		assert.StringContains(t, body, "Please wait 1 second before trying again")
+
+		// Even the right password has to wait.
+		code, body = login(t, "bob@example.com", "pa$$word")
+		assert.Equal(t, code, http.StatusTooManyRequests)
+		assert.StringContains(t, body, "Too many failed logins")
+	})
+
+	t.Run("Account lockout", func(t *testing.T) {
+		store.Put(accountLoginKey("alice@example.com"), nearlyLocked)
+
+		code, body := login(t, "alice@example.com", "wrong")
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+		assert.StringContains(t, body, "This account is locked after too many failed logins")
+
+		code, _ = login(t, "Alice@Example.com", "pa$$word")
+		assert.Equal(t, code, http.StatusTooManyRequests)
+
+		entries := audit.Entries()
+		assert.Equal(t, len(entries), 1)
+		assert.Equal(t, entries[0].Event, models.AuditAccountLocked)
+		assert.Equal(t, entries[0].UserId, 1)
+		assert.Equal(t, entries[0].IP, "127.0.0.1")
+
+		app.wg.Wait()
+		messages := mail.Messages()
+		assert.Equal(t, len(messages), 1)
+		assert.Equal(t, messages[0].To, "alice@example.com")
+		assert.StringContains(t, messages[0].Body,
+			"https://snippets.example.com/user/unlock?token="+mocks.MockUnlockToken)
+	})
+
+	t.Run("Unlock by email", func(t *testing.T) {
+		code, header, _ := ts.get(t, "/user/unlock?token=expired")
+		assert.Equal(t, code, http.StatusSeeOther)
+		_, _, body := ts.get(t, header.Get("Location"))
+		assert.StringContains(t, body, "That unlock link is invalid or has expired")
+
+		code, header, _ = ts.get(t, "/user/unlock?token="+mocks.MockUnlockToken)
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/user/login")
+		_, _, body = ts.get(t, "/user/login")
+		assert.StringContains(t, body, "Your account has been unlocked")
+
+		entries := audit.Entries()
+		assert.Equal(t, entries[len(entries)-1].Event, models.AuditAccountUnlocked)
+
+		code, _ = login(t, "alice@example.com", "pa$$word")
+		assert.Equal(t, code, http.StatusSeeOther)
+	})
+
+	t.Run("Unknown account", func(t *testing.T) {
+		store.Put(accountLoginKey("nobody@example.com"), nearlyLocked)
+		sent := len(mail.Messages())
+
+		code, body := login(t, "nobody@example.com", "wrong")
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+		assert.StringContains(t, body, "This account is locked")
+
+		entries := audit.Entries()
+		assert.Equal(t, entries[len(entries)-1].Event, models.AuditAccountLocked)
+		assert.Equal(t, entries[len(entries)-1].UserId, 0)
+		app.wg.Wait()
+		assert.Equal(t, len(mail.Messages()), sent)
+	})
+
+	t.Run("IP lockout", func(t *testing.T) {
+		store.Put(ipLoginKey("127.0.0.1"), lockout.Record{
+			Failures:    ipLoginPolicy.LockAfter - 1,
+			LastFailure: time.Now().Add(-2 * time.Minute),
+		})
+
+		code, body := login(t, "carol@example.com", "wrong")
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+		assert.StringContains(t, body, "Too many failed logins from your network")
+
+		entries := audit.Entries()
+		assert.Equal(t, entries[len(entries)-1].Event, models.AuditIPLocked)
+
+		code, _ = login(t, "carol@example.com", "pa$$word")
+		assert.Equal(t, code, http.StatusTooManyRequests)
+	})
+}
+
+func TestLoginLockoutConcurrent(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/user/login")
+
+	form := url.Values{}
+	form.Add("email", "bob@example.com")
+	form.Add("password", "wrong")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	// Guesses made all at once must not get past the backoff.
+	codes := make(chan int, 20)
+	var wg sync.WaitGroup
+	for range cap(codes) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			code, _, _ := ts.postForm(t, "/user/login", form)
+			codes <- code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	checked := 0
+	for code := range codes {
+		if code == http.StatusUnprocessableEntity {
+			checked++
+		}
+	}
+	assert.Equal(t, checked, accountLoginPolicy.Free+1)
+}
+
+// failingUsers is a user model whose database has gone away.
+type failingUsers struct {
+	mocks.UserModel
+}
+
+func (m *failingUsers) Authenticate(email, password string) (int, error) {
+	return 0, errors.New("database is down")
+}
+
+func TestLoginLockoutError(t *testing.T) {
+	app := newTestApplication(t)
+	app.users = &failingUsers{}
+
+	store := &lockout.Memory{}
+	app.accountGuard = lockout.New(store, accountLoginPolicy)
+	app.ipGuard = lockout.New(store, ipLoginPolicy)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/user/login")
+
+	form := url.Values{}
+	form.Add("email", "alice@example.com")
+	form.Add("password", "pa$$word")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, _, _ := ts.postForm(t, "/user/login", form)
+	assert.Equal(t, code, http.StatusInternalServerError)
+
+	// Logins that couldn't be checked don't count as failures.
+	for _, key := range []string{accountLoginKey("alice@example.com"), ipLoginKey("127.0.0.1")} {
+		rec, err := store.Get(key)
+		assert.NilErr(t, err)
+		assert.Equal(t, rec.Failures, 0)
+	}
+}
@@ -1,14 +1,24 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"database/sql"
+	"errors"
+	"expvar"
 	"flag"
 	"html/template"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"thienel/lets-go/internal/lockout"
+	"thienel/lets-go/internal/mailer"
 	"thienel/lets-go/internal/models"
+	"thienel/lets-go/internal/reaper"
 	"time"
 
 	"github.com/alexedwards/scs/mysqlstore"
@@ -22,10 +32,39 @@ type application struct {
 	infoLog        *log.Logger
 	snippets       models.SnippetModelInterface
 	users          models.UserModelInterface
+	tokens         models.TokenModelInterface
+	passwordResets models.PasswordResetModelInterface
+	verifications  models.EmailVerificationModelInterface
+	twoFactor      models.TwoFactorModelInterface
+	accountUnlocks models.AccountUnlockModelInterface
+	audit          models.AuditModelInterface
+	userSessions   models.UserSessionModelInterface
+	mailer         mailer.Mailer
 	templateCache  map[string]*template.Template
 	formDecoder    *form.Decoder
 	sessionManager *scs.SessionManager
-	debugMode      bool
+	// accountGuard and ipGuard count failed logins per account and per
+	// client address, twoFactorGuard wrong second-factor codes per user
+	// and snippetUnlockGuard wrong passwords per protected snippet.
+	// resetEmailGuard and resetIPGuard count password reset emails asked
+	// for per address and per client address, and verifyResendGuard
+	// verification emails per user.
+	accountGuard       *lockout.Guard
+	ipGuard            *lockout.Guard
+	twoFactorGuard     *lockout.Guard
+	snippetUnlockGuard *lockout.Guard
+	resetEmailGuard    *lockout.Guard
+	resetIPGuard       *lockout.Guard
+	verifyResendGuard  *lockout.Guard
+	debugMode          bool
+	// wg tracks work started by background, so that it can finish before
+	// the application exits.
+	wg sync.WaitGroup
+	// baseURL is where the application is served, for links in emails and
+	// paste replies.
+	// It is configured rather than taken from the Host header, which
+	// anyone can set.
+	baseURL string
 }
 
 func main() {
@@ -33,6 +72,21 @@ func main() {
 	debug := flag.Bool("debug", false, "Debug mode")
 	dsn := flag.String("dsn", "web:pass@/snippetbox?parseTime=true",
 		"MySQL data source name")
+	reapInterval := flag.Duration("reap-interval", 10*time.Minute,
+		"How often to delete expired snippets, sessions and emailed tokens")
+	metricsAddr := flag.String("metrics-addr", "",
+		"Address to serve expvar metrics on, e.g. localhost:4001; off if empty")
+	baseURL := flag.String("base-url", "https://localhost:4000",
+		"Public address of the application, used in emailed links")
+	smtpHost := flag.String("smtp-host", "",
+		"SMTP server host; if empty, emails are written to -mail-dir")
+	smtpPort := flag.Int("smtp-port", 587, "SMTP server port")
+	smtpUsername := flag.String("smtp-username", "", "SMTP username")
+	smtpPassword := flag.String("smtp-password", "", "SMTP password")
+	smtpSender := flag.String("smtp-sender", "Snippetbox <no-reply@snippetbox.local>",
+		"Sender of emails")
+	mailDir := flag.String("mail-dir", "./tmp/mail",
+		"Directory emails are written to when no SMTP server is set")
 
 	flag.Parse()
 
@@ -52,19 +106,51 @@ func main() {
 
 	formDecoder := form.NewDecoder()
 	sessionManager := scs.New()
-	sessionManager.Store = mysqlstore.New(db)
+	sessionManager.Store = mysqlstore.NewWithCleanupInterval(db, *reapInterval)
 	sessionManager.Lifetime = 12 * time.Hour
 	sessionManager.Cookie.Secure = true
 
+	var mail mailer.Mailer = &mailer.File{Dir: *mailDir, Sender: *smtpSender}
+	if *smtpHost != "" {
+		mail, err = mailer.NewSMTP(*smtpHost, *smtpPort, *smtpUsername,
+			*smtpPassword, *smtpSender)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+	}
+
+	snippets := &models.SnippetModel{DB: db}
+	userSessions := &models.UserSessionModel{DB: db}
+	passwordResets := &models.PasswordResetModel{DB: db}
+	verifications := &models.EmailVerificationModel{DB: db}
+	accountUnlocks := &models.AccountUnlockModel{DB: db}
+	loginAttempts := &lockout.MySQL{DB: db}
+
 	app := &application{
-		errorLog:       errorLog,
-		infoLog:        infoLog,
-		snippets:       &models.SnippetModel{DB: db},
-		users:          &models.UserModel{DB: db},
-		templateCache:  templateCache,
-		formDecoder:    formDecoder,
-		sessionManager: sessionManager,
-		debugMode:      *debug,
+		errorLog:           errorLog,
+		infoLog:            infoLog,
+		snippets:           snippets,
+		users:              &models.UserModel{DB: db},
+		tokens:             &models.TokenModel{DB: db},
+		passwordResets:     passwordResets,
+		verifications:      verifications,
+		twoFactor:          &models.TwoFactorModel{DB: db},
+		accountUnlocks:     accountUnlocks,
+		audit:              &models.AuditModel{DB: db},
+		userSessions:       userSessions,
+		mailer:             mail,
+		templateCache:      templateCache,
+		formDecoder:        formDecoder,
+		sessionManager:     sessionManager,
+		accountGuard:       lockout.New(loginAttempts, accountLoginPolicy),
+		ipGuard:            lockout.New(loginAttempts, ipLoginPolicy),
+		twoFactorGuard:     lockout.New(loginAttempts, twoFactorLoginPolicy),
+		snippetUnlockGuard: lockout.New(loginAttempts, snippetUnlockPolicy),
+		resetEmailGuard:    lockout.New(loginAttempts, resetEmailPolicy),
+		resetIPGuard:       lockout.New(loginAttempts, resetIPPolicy),
+		verifyResendGuard:  lockout.New(loginAttempts, verifyResendPolicy),
+		debugMode:          *debug,
+		baseURL:            strings.TrimRight(*baseURL, "/"),
 	}
 
 	tlsConfig := &tls.Config{
@@ -81,9 +167,80 @@ func main() {
 		WriteTimeout: 10 * time.Second,
 	}
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt,
+		syscall.SIGTERM)
+	defer stop()
+
+	// Expired scs sessions are cleaned up by the session store itself;
+	// everything else that expires is left to the reapers.
+	newReaper := func(name string, store reaper.Store) *reaper.Reaper {
+		return reaper.New(name, store, *reapInterval, 500, infoLog, errorLog)
+	}
+	reapers := []*reaper.Reaper{
+		newReaper("snippets", snippets),
+		newReaper("user sessions", userSessions),
+		newReaper("password reset tokens", passwordResets),
+		newReaper("email verification tokens", verifications),
+		newReaper("account unlock tokens", accountUnlocks),
+	}
+	reaper.Publish(reapers...)
+
+	var wg sync.WaitGroup
+	for _, r := range reapers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.Run(ctx)
+		}()
+	}
+
+	// The metrics are served apart from the application, on an address
+	// that needn't be public.
+	if *metricsAddr != "" {
+		go func() {
+			infoLog.Printf("Serving metrics on %s", *metricsAddr)
+			err := http.ListenAndServe(*metricsAddr, expvar.Handler())
+			if err != nil {
+				errorLog.Print(err)
+			}
+		}()
+	}
+
+	// ListenAndServeTLS returns as soon as Shutdown starts, so the result
+	// of Shutdown is passed back once in-flight requests have finished.
+	shutdownErr := make(chan error)
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(),
+			10*time.Second)
+		defer cancel()
+
+		shutdownErr <- srv.Shutdown(shutdownCtx)
+	}()
+
 	infoLog.Printf("Starting server on %s", *addr)
 	err = srv.ListenAndServeTLS("./tls/cert.pem", "./tls/key.pem")
-	errorLog.Fatal(err)
+	if !errors.Is(err, http.ErrServerClosed) {
+		errorLog.Fatal(err)
+	}
+
+	err = <-shutdownErr
+	if err != nil {
+		errorLog.Print(err)
+	}
+
+	// No requests are left to start background work, so it is safe to
+	// wait for it.
+	wg.Wait()
+	app.wg.Wait()
+
+	infoLog.Print("Stopped server")
+	for _, r := range reapers {
+		stats := r.Stats()
+		infoLog.Printf("Reaper purged %d %s in %d sweeps", stats.Purged,
+			r.Name(), stats.Sweeps)
+	}
 }
 
 func openDB(dsn string) (*sql.DB, error) {
@@ -2,9 +2,13 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"thienel/lets-go/internal/models"
 
+	"github.com/justinas/alice"
 	"github.com/justinas/nosurf"
 )
 
@@ -56,6 +60,127 @@ func (app *application) requireAuthentication(next http.Handler) http.Handler {
 	})
 }
 
+// requireAPIAuthentication is the API counterpart of requireAuthentication.
+// It responds with a JSON error instead of redirecting to the login page.
+func (app *application) requireAPIAuthentication(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.isAuthenticated(r) {
+			app.apiError(w, http.StatusUnauthorized,
+				"you must be authenticated to access this resource")
+			return
+		}
+
+		w.Header().Add("Cache-Control", "no-store")
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireVerifiedEmail sends users who haven't verified their email address
+// to their account page, where they can ask for another link. It must come
+// after requireAuthentication.
+func (app *application) requireVerifiedEmail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		verified, err := app.emailVerified(r)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		if !verified {
+			app.sessionManager.Put(r.Context(), "flash",
+				"Please verify your email address before creating snippets")
+			http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireAPIVerifiedEmail is the API counterpart of requireVerifiedEmail.
+func (app *application) requireAPIVerifiedEmail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		verified, err := app.emailVerified(r)
+		if err != nil {
+			app.apiServerError(w, err)
+			return
+		}
+
+		if !verified {
+			app.apiError(w, http.StatusForbidden,
+				"you must verify your email address before creating snippets")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticateToken is the API counterpart of authenticate. Requests with
+// an "Authorization: Bearer" header are authenticated by personal access
+// token, which takes precedence over any session.
+func (app *application) authenticateToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		plaintext, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			app.invalidTokenResponse(w)
+			return
+		}
+
+		token, err := app.tokens.Authenticate(plaintext)
+		if err != nil {
+			if errors.Is(err, models.ErrInvalidCredentials) {
+				app.invalidTokenResponse(w)
+			} else {
+				app.apiServerError(w, err)
+			}
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+		ctx = context.WithValue(ctx, apiTokenContextKey, token)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requireScope rejects requests authenticated by a token that lacks scope.
+// Requests authenticated by session, or not at all, are let through.
+func (app *application) requireScope(scope string) alice.Constructor {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := apiToken(r)
+			if token != nil && !token.HasScope(scope) {
+				app.apiError(w, http.StatusForbidden,
+					fmt.Sprintf("this token does not have the %q scope", scope))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// limitBody caps request bodies at n bytes. It has to come before noSurf,
+// which reads form bodies to find the CSRF token.
+func limitBody(n int64) alice.Constructor {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Body = http.MaxBytesReader(w, r.Body, n)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func (app *application) noSurf(next http.Handler) http.Handler {
 	csrfHandler := nosurf.New(next)
 	csrfHandler.SetBaseCookie(http.Cookie{
@@ -75,15 +200,26 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
-		exists, err := app.users.Exists(id)
+		// The session may have been logged out from another one, or the
+		// user deleted, since the last request.
+		var active bool
+		var err error
+		if key := app.sessionManager.GetString(r.Context(), "sessionKey"); key != "" {
+			active, err = app.userSessions.Touch(key, id, clientIP(r))
+		} else {
+			active, err = app.recordLegacySession(r, id)
+		}
 		if err != nil {
 			app.serverError(w, err)
 			return
 		}
 
-		if exists {
+		if active {
 			ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
 			r = r.WithContext(ctx)
+		} else {
+			app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+			app.sessionManager.Remove(r.Context(), "sessionKey")
 		}
 
 		next.ServeHTTP(w, r)
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"thienel/lets-go/internal/models"
+	"time"
+)
+
+// maxPasteBytes limits the size of paste request bodies. The content itself
+// is held to maxContentBytes by validateSnippetForm.
+const maxPasteBytes = 1 << 20
+
+// pasteField is the multipart field holding the content, as in
+// `curl -F 'f=<-'` or `curl -F 'f=@file'`.
+const pasteField = "f"
+
+var errPasteTooLarge = fmt.Errorf("paste must not be larger than %d bytes", maxPasteBytes)
+
+// readPaste builds a snippet form from a paste request. Multipart bodies
+// carry the content in the f field and any other form fields alongside it.
+// Any other body is taken as the content itself, with the form fields in
+// the query string.
+func (app *application) readPaste(w http.ResponseWriter, r *http.Request) (snippetCreateForm, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxPasteBytes)
+
+	var form snippetCreateForm
+	var values url.Values
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		err := r.ParseMultipartForm(maxPasteBytes)
+		if err != nil {
+			return form, pasteReadError(err)
+		}
+		values = r.PostForm
+
+		if file, _, err := r.FormFile(pasteField); err == nil {
+			defer file.Close()
+			b, err := io.ReadAll(file)
+			if err != nil {
+				return form, err
+			}
+			form.Content = string(b)
+		} else {
+			form.Content = values.Get(pasteField)
+		}
+	} else {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			return form, pasteReadError(err)
+		}
+		form.Content = string(b)
+		values = r.URL.Query()
+	}
+
+	// The content never comes from a content field, so that it can't be
+	// given twice.
+	values = maps.Clone(values)
+	delete(values, "content")
+	delete(values, pasteField)
+
+	err := app.formDecoder.Decode(&form, values)
+	if err != nil {
+		return form, err
+	}
+
+	if form.Title == "" {
+		form.Title = "Untitled"
+	}
+	if form.Visibility == "" {
+		form.Visibility = models.VisibilityPublic
+	}
+	if form.Expires == "" {
+		form.Expires = "365d"
+	}
+
+	return form, nil
+}
+
+func pasteReadError(err error) error {
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) || errors.Is(err, multipart.ErrMessageTooLarge) {
+		return errPasteTooLarge
+	}
+	return err
+}
+
+// pastePost creates a snippet for command-line clients, e.g.
+//
+//	cat log.txt | curl -H 'Authorization: Bearer sb_...' -F 'f=<-' https://host/
+//
+// and replies with its URL as plain text. It runs without the session, so
+// a cookie can never authenticate it and it needs no CSRF token; clients
+// authenticate with an API token that has the write scope.
+func (app *application) pastePost(w http.ResponseWriter, r *http.Request) {
+	token := apiToken(r)
+	if token == nil {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "An API token is required to paste", http.StatusUnauthorized)
+		return
+	}
+	if !token.HasScope(models.ScopeWrite) {
+		http.Error(w, `This token does not have the "write" scope`, http.StatusForbidden)
+		return
+	}
+
+	verified, err := app.emailVerified(r)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if !verified {
+		http.Error(w, "You must verify your email address before pasting",
+			http.StatusForbidden)
+		return
+	}
+
+	form, err := app.readPaste(w, r)
+	if err != nil {
+		if errors.Is(err, errPasteTooLarge) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		} else {
+			app.clientError(w, http.StatusBadRequest)
+		}
+		return
+	}
+
+	validateSnippetForm(&form)
+
+	if !form.Valid() {
+		fields := make([]string, 0, len(form.FieldErrors))
+		for field, msg := range form.FieldErrors {
+			fields = append(fields, field+": "+msg)
+		}
+		slices.Sort(fields)
+		http.Error(w, strings.Join(fields, "\n"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	_, slug, err := app.snippets.Insert(token.UserId, form.Title, form.Content,
+		form.Language, form.Visibility, form.expiry(time.Now()),
+		form.BurnAfterReading, form.Password, form.tagList())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	u := app.baseURL + snippetURL(slug, "")
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Location", u)
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintln(w, u)
+}
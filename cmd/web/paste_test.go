@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+	"thienel/lets-go/internal/assert"
+	"thienel/lets-go/internal/models/mocks"
+)
+
+// multipartBody encodes fields, and files if any, as multipart/form-data
+// and returns the body with its Content-Type. Files are all given filename.
+func multipartBody(t *testing.T, fields, files map[string]string,
+	filename string) (string, string) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	for name, value := range fields {
+		err := mw.WriteField(name, value)
+		assert.NilErr(t, err)
+	}
+	for name, content := range files {
+		fw, err := mw.CreateFormFile(name, filename)
+		assert.NilErr(t, err)
+		fw.Write([]byte(content))
+	}
+
+	err := mw.Close()
+	assert.NilErr(t, err)
+
+	return buf.String(), mw.FormDataContentType()
+}
+
+func TestPastePost(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	withToken := func(token, contentType string) http.Header {
+		h := http.Header{"Content-Type": {contentType}}
+		if token != "" {
+			h.Set("Authorization", "Bearer "+token)
+		}
+		return h
+	}
+
+	fieldBody, fieldType := multipartBody(t,
+		map[string]string{"f": "line one\nline two\n", "title": "Build log"}, nil, "")
+	fileBody, fileType := multipartBody(t, nil,
+		map[string]string{"f": "package main\n"}, "main.go")
+
+	const textPlain = "text/plain"
+	// Links are built from the configured base URL, not the Host header.
+	wantURL := app.baseURL + "/s/bmV3LXNuaXBw\n"
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		header   http.Header
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Multipart field",
+			urlPath:  "/",
+			header:   withToken(mocks.MockReadWriteToken, fieldType),
+			body:     fieldBody,
+			wantCode: http.StatusCreated,
+			wantBody: wantURL,
+		},
+		{
+			name:     "Multipart file",
+			urlPath:  "/",
+			header:   withToken(mocks.MockReadWriteToken, fileType),
+			body:     fileBody,
+			wantCode: http.StatusCreated,
+			wantBody: wantURL,
+		},
+		{
+			name:     "Raw body",
+			urlPath:  "/?title=Build+log&language=go&expires=1d",
+			header:   withToken(mocks.MockReadWriteToken, textPlain),
+			body:     "package main\n",
+			wantCode: http.StatusCreated,
+			wantBody: wantURL,
+		},
+		{
+			name:     "Empty body",
+			urlPath:  "/",
+			header:   withToken(mocks.MockReadWriteToken, textPlain),
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "content: This field cannot be blank",
+		},
+		{
+			name:     "Invalid option",
+			urlPath:  "/?expires=forever",
+			header:   withToken(mocks.MockReadWriteToken, textPlain),
+			body:     "package main\n",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "expires: This field must be one of the listed options",
+		},
+		{
+			name:     "Content too large",
+			urlPath:  "/",
+			header:   withToken(mocks.MockReadWriteToken, textPlain),
+			body:     strings.Repeat("a", maxContentBytes+1),
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "content: This field cannot be larger than 64 KB",
+		},
+		{
+			name:     "NUL byte",
+			urlPath:  "/",
+			header:   withToken(mocks.MockReadWriteToken, textPlain),
+			body:     "package main\x00\n",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "content: This field must be UTF-8 text without NUL characters",
+		},
+		{
+			name:     "Too large",
+			urlPath:  "/",
+			header:   withToken(mocks.MockReadWriteToken, textPlain),
+			body:     strings.Repeat("a", maxPasteBytes+1),
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:     "No token",
+			urlPath:  "/",
+			header:   withToken("", textPlain),
+			body:     "package main\n",
+			wantCode: http.StatusUnauthorized,
+			wantBody: "An API token is required to paste",
+		},
+		{
+			name:     "Read-only token",
+			urlPath:  "/",
+			header:   withToken(mocks.MockReadToken, textPlain),
+			body:     "package main\n",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Unverified user",
+			urlPath:  "/",
+			header:   withToken(mocks.MockUnverifiedToken, textPlain),
+			body:     "package main\n",
+			wantCode: http.StatusForbidden,
+			wantBody: "You must verify your email address before pasting",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.request(t, http.MethodPost, tt.urlPath, tt.header, tt.body)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.StringContains(t, body, tt.wantBody)
+		})
+	}
+
+	// A browser session must not be enough, or any site could paste on a
+	// signed-in user's behalf.
+	t.Run("Session is ignored", func(t *testing.T) {
+		ts.login(t, "alice@example.com", "pa$$word")
+
+		code, _, _ := ts.request(t, http.MethodPost, "/",
+			withToken("", textPlain), "package main\n")
+		assert.Equal(t, code, http.StatusUnauthorized)
+	})
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
+	"strings"
+	"thienel/lets-go/internal/models"
 	"thienel/lets-go/ui"
 
 	"github.com/julienschmidt/httprouter"
@@ -13,8 +16,21 @@ func (app *application) routes() http.Handler {
 
 	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter,
 		r *http.Request) {
+		if isAPIRequest(r) {
+			app.apiNotFound(w)
+			return
+		}
 		app.notFound(w)
 	})
+	router.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		if isAPIRequest(r) {
+			app.apiError(w, http.StatusMethodNotAllowed,
+				fmt.Sprintf("the %s method is not supported for this resource", r.Method))
+			return
+		}
+		app.clientError(w, http.StatusMethodNotAllowed)
+	})
 
 	fileServer := http.FileServer(http.FS(ui.Files))
 	router.Handler(http.MethodGet, "/static/*filepath", fileServer)
@@ -27,8 +43,36 @@ func (app *application) routes() http.Handler {
 		dynamic.ThenFunc(app.home))
 	router.Handler(http.MethodGet, "/home",
 		dynamic.ThenFunc(app.home))
-	router.Handler(http.MethodGet, "/snippet/view/:id",
+	router.Handler(http.MethodGet, "/snippets",
+		dynamic.ThenFunc(app.snippetBrowse))
+	router.Handler(http.MethodGet, "/tag/:name",
+		dynamic.ThenFunc(app.tagView))
+	router.Handler(http.MethodGet, "/search",
+		dynamic.ThenFunc(app.search))
+	router.Handler(http.MethodGet, "/s/:slug",
 		dynamic.ThenFunc(app.snippetView))
+	router.Handler(http.MethodPost, "/s/:slug",
+		dynamic.ThenFunc(app.snippetBurnPost))
+	router.Handler(http.MethodPost, "/s/:slug/unlock",
+		dynamic.ThenFunc(app.snippetUnlockPost))
+	router.Handler(http.MethodGet, "/s/:slug/raw",
+		dynamic.ThenFunc(app.snippetRaw))
+	router.Handler(http.MethodGet, "/s/:slug/download",
+		dynamic.ThenFunc(app.snippetDownload))
+	router.Handler(http.MethodGet, "/s/:slug/history",
+		dynamic.ThenFunc(app.snippetHistory))
+	router.Handler(http.MethodGet, "/s/:slug/diff",
+		dynamic.ThenFunc(app.snippetDiff))
+	router.Handler(http.MethodGet, "/snippet/view/:id",
+		dynamic.Then(app.snippetRedirect("")))
+	router.Handler(http.MethodGet, "/snippet/raw/:id",
+		dynamic.Then(app.snippetRedirect("/raw")))
+	router.Handler(http.MethodGet, "/snippet/download/:id",
+		dynamic.Then(app.snippetRedirect("/download")))
+	router.Handler(http.MethodGet, "/snippet/view/:id/history",
+		dynamic.Then(app.snippetRedirect("/history")))
+	router.Handler(http.MethodGet, "/snippet/view/:id/diff",
+		dynamic.Then(app.snippetRedirect("/diff")))
 	router.Handler(http.MethodGet, "/user/signup",
 		dynamic.ThenFunc(app.userSignup))
 	router.Handler(http.MethodPost, "/user/signup",
@@ -37,15 +81,38 @@ func (app *application) routes() http.Handler {
 		dynamic.ThenFunc(app.userLogin))
 	router.Handler(http.MethodPost, "/user/login",
 		dynamic.ThenFunc(app.userLoginPost))
+	router.Handler(http.MethodGet, "/user/login/2fa",
+		dynamic.ThenFunc(app.userLoginTwoFactor))
+	router.Handler(http.MethodPost, "/user/login/2fa",
+		dynamic.ThenFunc(app.userLoginTwoFactorPost))
+	router.Handler(http.MethodGet, "/user/unlock",
+		dynamic.ThenFunc(app.userUnlock))
+	router.Handler(http.MethodGet, "/user/verify",
+		dynamic.ThenFunc(app.userVerifyEmail))
+	router.Handler(http.MethodGet, "/user/password/forgot",
+		dynamic.ThenFunc(app.userForgotPassword))
+	router.Handler(http.MethodPost, "/user/password/forgot",
+		dynamic.ThenFunc(app.userForgotPasswordPost))
+	router.Handler(http.MethodGet, "/user/password/reset",
+		dynamic.ThenFunc(app.userResetPassword))
+	router.Handler(http.MethodPost, "/user/password/reset",
+		dynamic.ThenFunc(app.userResetPasswordPost))
 	router.Handler(http.MethodGet, "/about",
 		dynamic.ThenFunc(app.about))
 
 	protected := dynamic.Append(app.requireAuthentication)
 
 	router.Handler(http.MethodGet, "/snippet/create",
-		protected.ThenFunc(app.snippetCreate))
+		protected.Append(app.requireVerifiedEmail).ThenFunc(app.snippetCreate))
 	router.Handler(http.MethodPost, "/snippet/create",
-		protected.ThenFunc(app.snippetCreatePost))
+		alice.New(limitBody(maxFormBytes)).Extend(protected).
+			Append(app.requireVerifiedEmail).ThenFunc(app.snippetCreatePost))
+	router.Handler(http.MethodGet, "/snippet/edit/:id",
+		protected.ThenFunc(app.snippetEdit))
+	router.Handler(http.MethodPost, "/snippet/edit/:id",
+		protected.ThenFunc(app.snippetEditPost))
+	router.Handler(http.MethodPost, "/snippet/delete/:id",
+		protected.ThenFunc(app.snippetDeletePost))
 	router.Handler(http.MethodPost, "/user/logout",
 		protected.ThenFunc(app.userLogoutPost))
 	router.Handler(http.MethodGet, "/account/password/update",
@@ -54,8 +121,62 @@ func (app *application) routes() http.Handler {
 		protected.ThenFunc(app.passowrdUpdatePost))
 	router.Handler(http.MethodGet, "/account/view",
 		protected.ThenFunc(app.account))
+	router.Handler(http.MethodGet, "/account/trash",
+		protected.ThenFunc(app.trash))
+	router.Handler(http.MethodPost, "/account/trash/restore/:id",
+		protected.ThenFunc(app.trashRestorePost))
+	router.Handler(http.MethodPost, "/account/trash/purge/:id",
+		protected.ThenFunc(app.trashPurgePost))
+	router.Handler(http.MethodGet, "/account/2fa",
+		protected.ThenFunc(app.accountTwoFactor))
+	router.Handler(http.MethodGet, "/account/2fa/qr.png",
+		protected.ThenFunc(app.accountTwoFactorQR))
+	router.Handler(http.MethodPost, "/account/2fa/enable",
+		protected.ThenFunc(app.accountTwoFactorEnablePost))
+	router.Handler(http.MethodPost, "/account/2fa/disable",
+		protected.ThenFunc(app.accountTwoFactorDisablePost))
+	router.Handler(http.MethodPost, "/account/verify/resend",
+		protected.ThenFunc(app.accountVerifyResendPost))
+	router.Handler(http.MethodPost, "/account/tokens/create",
+		protected.ThenFunc(app.tokenCreatePost))
+	router.Handler(http.MethodPost, "/account/tokens/revoke/:id",
+		protected.ThenFunc(app.tokenRevokePost))
+	router.Handler(http.MethodPost, "/account/sessions/revoke/:id",
+		protected.ThenFunc(app.accountSessionRevokePost))
+	router.Handler(http.MethodPost, "/account/sessions/revoke-others",
+		protected.ThenFunc(app.accountSessionsRevokeOthersPost))
+
+	// The API uses neither nosurf nor HTML error pages. Requests that change
+	// state must be application/json, which forms on other sites can't send,
+	// or be authenticated by a bearer token rather than a cookie.
+	api := alice.New(app.sessionManager.LoadAndSave, app.authenticate,
+		app.authenticateToken)
+	apiRead := api.Append(app.requireScope(models.ScopeRead))
+
+	router.Handler(http.MethodGet, "/api/v1/snippets",
+		apiRead.ThenFunc(app.apiSnippetList))
+	router.Handler(http.MethodGet, "/api/v1/snippets/:slug",
+		apiRead.ThenFunc(app.apiSnippetGet))
+	router.Handler(http.MethodGet, "/api/v1/search",
+		apiRead.ThenFunc(app.apiSnippetSearch))
+
+	apiWrite := api.Append(app.requireAPIAuthentication,
+		app.requireScope(models.ScopeWrite), app.requireAPIVerifiedEmail)
+
+	router.Handler(http.MethodPost, "/api/v1/snippets",
+		apiWrite.ThenFunc(app.apiSnippetCreate))
+
+	// Pastes from curl and similar clients. The session is deliberately not
+	// loaded: only an API token can authenticate these requests, which is
+	// why they are safe without CSRF protection.
+	router.Handler(http.MethodPost, "/",
+		alice.New(app.authenticateToken).ThenFunc(app.pastePost))
 
 	standard := alice.New(app.recoverPanic, app.logRequest, secureHeaders)
 
 	return standard.Then(router)
 }
+
+func isAPIRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/")
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"thienel/lets-go/internal/models"
+)
+
+// otherSessions describes a number of logged-out sessions for flash
+// messages, e.g. "2 other sessions".
+func otherSessions(n int) string {
+	if n == 1 {
+		return "1 other session"
+	}
+	return fmt.Sprintf("%d other sessions", n)
+}
+
+// recordLegacySession records a session that was logged in before sessions
+// were recorded, and so has no key, as if it had just logged in. It reports
+// whether the user still exists, as checked before sessions were recorded.
+func (app *application) recordLegacySession(r *http.Request, id int) (bool, error) {
+	exists, err := app.users.Exists(id)
+	if err != nil || !exists {
+		return false, err
+	}
+
+	key, err := app.userSessions.Insert(id, r.UserAgent(), clientIP(r),
+		app.sessionManager.Lifetime)
+	if err != nil {
+		return false, err
+	}
+
+	app.sessionManager.Put(r.Context(), "sessionKey", key)
+
+	return true, nil
+}
+
+func (app *application) accountSessionRevokePost(w http.ResponseWriter, r *http.Request) {
+	id, ok := readIDParam(r)
+	if !ok {
+		app.notFound(w)
+		return
+	}
+
+	err := app.userSessions.Delete(id, app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Session logged out")
+
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+func (app *application) accountSessionsRevokeOthersPost(w http.ResponseWriter, r *http.Request) {
+	n, err := app.userSessions.DeleteOthers(app.authenticatedUserID(r),
+		app.sessionManager.GetString(r.Context(), "sessionKey"))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	flash := "There were no other sessions to log out"
+	if n > 0 {
+		flash = fmt.Sprintf("Logged out of %s", otherSessions(n))
+	}
+	app.sessionManager.Put(r.Context(), "flash", flash)
+
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
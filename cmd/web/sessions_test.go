@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"thienel/lets-go/internal/assert"
+	"thienel/lets-go/internal/models/mocks"
+)
+
+// loginTwice logs Alice in from two clients of ts, leaving the second one
+// in use. It returns a function that switches to the first.
+func loginTwice(t *testing.T, ts *testServer) (first func()) {
+	ts.login(t, "alice@example.com", "pa$$word")
+	jar := ts.Client().Jar
+
+	ts.resetCookies(t)
+	ts.login(t, "alice@example.com", "pa$$word")
+
+	return func() {
+		ts.Client().Jar = jar
+	}
+}
+
+func TestAccountSessionsRevokeOthers(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	useFirst := loginTwice(t, ts)
+
+	code, _, body := ts.get(t, "/account/view")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "Active sessions")
+	assert.StringContains(t, body, "(this session)")
+	assert.StringContains(t, body, "Log out this session")
+
+	form := url.Values{}
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, header, _ := ts.postForm(t, "/account/sessions/revoke-others", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/account/view")
+
+	_, _, body = ts.get(t, "/account/view")
+	assert.StringContains(t, body, "Logged out of 1 other session")
+
+	code, _, _ = ts.postForm(t, "/account/sessions/revoke-others", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	_, _, body = ts.get(t, "/account/view")
+	assert.StringContains(t, body, "There were no other sessions to log out")
+
+	useFirst()
+
+	code, header, _ = ts.get(t, "/account/view")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/user/login")
+}
+
+func TestAccountSessionRevoke(t *testing.T) {
+	app := newTestApplication(t)
+	sessions := app.userSessions.(*mocks.UserSessionModel)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Bob's session can't be logged out by Alice.
+	ts.login(t, "bob@example.com", "pa$$word")
+	bobs, err := sessions.GetByUser(2, "")
+	assert.NilErr(t, err)
+	ts.resetCookies(t)
+
+	useFirst := loginTwice(t, ts)
+
+	alices, err := sessions.GetByUser(1, "")
+	assert.NilErr(t, err)
+	assert.Equal(t, len(alices), 2)
+
+	// The mock lists the newest session first.
+	first := alices[1]
+
+	_, _, body := ts.get(t, "/account/view")
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+	}{
+		{"Other user's session", fmt.Sprintf("/account/sessions/revoke/%d", bobs[0].Id), http.StatusNotFound},
+		{"Missing session", "/account/sessions/revoke/99", http.StatusNotFound},
+		{"Invalid ID", "/account/sessions/revoke/foo", http.StatusNotFound},
+		{"Own session", fmt.Sprintf("/account/sessions/revoke/%d", first.Id), http.StatusSeeOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+
+			code, _, _ := ts.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+
+	_, _, body = ts.get(t, "/account/view")
+	assert.StringContains(t, body, "Session logged out")
+
+	useFirst()
+
+	code, header, _ := ts.get(t, "/account/view")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/user/login")
+}
+
+func TestPasswordChangeLogsOutOtherSessions(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	useFirst := loginTwice(t, ts)
+
+	_, _, body := ts.get(t, "/account/password/update")
+
+	form := url.Values{}
+	form.Add("currentPassword", "pa$$word")
+	form.Add("newPassword", "new-pa$$word")
+	form.Add("confirmNewPassword", "new-pa$$word")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, _, _ := ts.postForm(t, "/account/password/update", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	_, _, body = ts.get(t, "/")
+	assert.StringContains(t, body, "1 other session logged out")
+
+	code, _, _ = ts.get(t, "/account/view")
+	assert.Equal(t, code, http.StatusOK)
+
+	useFirst()
+
+	code, _, _ = ts.get(t, "/account/view")
+	assert.Equal(t, code, http.StatusSeeOther)
+}
+
+func TestUserLogoutEndsSession(t *testing.T) {
+	app := newTestApplication(t)
+	sessions := app.userSessions.(*mocks.UserSessionModel)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "alice@example.com", "pa$$word")
+
+	alices, err := sessions.GetByUser(1, "")
+	assert.NilErr(t, err)
+	assert.Equal(t, len(alices), 1)
+
+	_, _, body := ts.get(t, "/account/view")
+
+	form := url.Values{}
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, _, _ := ts.postForm(t, "/user/logout", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	alices, err = sessions.GetByUser(1, "")
+	assert.NilErr(t, err)
+	assert.Equal(t, len(alices), 0)
+}
+
+func TestLegacySession(t *testing.T) {
+	app := newTestApplication(t)
+	sessions := app.userSessions.(*mocks.UserSessionModel)
+
+	// Sessions logged in before sessions were recorded only have the user's
+	// id in them.
+	mux := http.NewServeMux()
+	mux.Handle("/", app.routes())
+	mux.Handle("/legacy-login", app.sessionManager.LoadAndSave(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			app.sessionManager.Put(r.Context(), "authenticatedUserID", 1)
+		})))
+
+	ts := newTestServer(t, mux)
+	defer ts.Close()
+
+	ts.get(t, "/legacy-login")
+
+	// They stay logged in, and are recorded once.
+	for range 2 {
+		code, _, body := ts.get(t, "/account/view")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "(this session)")
+
+		alices, err := sessions.GetByUser(1, "")
+		assert.NilErr(t, err)
+		assert.Equal(t, len(alices), 1)
+	}
+
+	// From then on they can be logged out like any other.
+	_, err := sessions.DeleteOthers(1, "")
+	assert.NilErr(t, err)
+
+	code, _, _ := ts.get(t, "/account/view")
+	assert.Equal(t, code, http.StatusSeeOther)
+}
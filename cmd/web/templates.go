@@ -4,20 +4,48 @@ import (
 	"html/template"
 	"io/fs"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"thienel/lets-go/internal/diff"
 	"thienel/lets-go/internal/models"
+	"thienel/lets-go/internal/syntax"
 	"thienel/lets-go/ui"
 	"time"
+	"unicode/utf8"
 )
 
 type templateData struct {
-	CurrentYear     int
-	Snippet         *models.Snippet
-	Snippets        []*models.Snippet
-	Form            any
-	Flash           string
-	IsAuthenticated bool
-	CSRFToken       string
-	Account         *models.User
+	CurrentYear         int
+	Snippet             *models.Snippet
+	Snippets            []*models.Snippet
+	Form                any
+	Flash               string
+	IsAuthenticated     bool
+	AuthenticatedUserID int
+	CSRFToken           string
+	Account             *models.User
+	Revisions           []*models.Revision
+	DiffFrom            *models.Revision
+	DiffTo              *models.Revision
+	Diff                []diff.Hunk
+	Pagination          *pagination
+	SearchQuery         string
+	Tag                 string
+	Tags                []*models.Tag
+	Tokens              []*models.Token
+	NewToken            string
+	Sessions            []*models.UserSession
+	TOTPSecret          string
+	RecoveryCodes       []string
+	RecoveryCodesLeft   int
+}
+
+// pagination holds the links to the neighbouring pages of a listing. An
+// empty link means there is no page in that direction.
+type pagination struct {
+	Prev string
+	Next string
 }
 
 func newTemplateCache() (map[string]*template.Template, error) {
@@ -55,6 +83,115 @@ func humanDate(t time.Time) string {
 	return t.UTC().Format("02 Jan 2006 at 15:04")
 }
 
+// searchTerms builds a case-insensitive pattern matching any word of query.
+// It returns nil if query has no words.
+func searchTerms(query string) *regexp.Regexp {
+	words := strings.Fields(query)
+	if len(words) == 0 {
+		return nil
+	}
+
+	for i := range words {
+		words[i] = regexp.QuoteMeta(words[i])
+	}
+
+	return regexp.MustCompile("(?i)" + strings.Join(words, "|"))
+}
+
+// highlight escapes s and wraps every occurrence of a word of query in a
+// <mark> element.
+func highlight(s, query string) template.HTML {
+	rx := searchTerms(query)
+	if rx == nil {
+		return template.HTML(template.HTMLEscapeString(s))
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, loc := range rx.FindAllStringIndex(s, -1) {
+		b.WriteString(template.HTMLEscapeString(s[last:loc[0]]))
+		b.WriteString("<mark>")
+		b.WriteString(template.HTMLEscapeString(s[loc[0]:loc[1]]))
+		b.WriteString("</mark>")
+		last = loc[1]
+	}
+	b.WriteString(template.HTMLEscapeString(s[last:]))
+
+	return template.HTML(b.String())
+}
+
+// excerpt returns at most n runes of s, centred on the first match of a
+// word of query when there is one.
+func excerpt(s, query string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+
+	start := 0
+	if rx := searchTerms(query); rx != nil {
+		if loc := rx.FindStringIndex(s); loc != nil {
+			start = max(utf8.RuneCountInString(s[:loc[0]])-n/2, 0)
+		}
+	}
+	start = min(start, len(runes)-n)
+
+	out := string(runes[start : start+n])
+	if start > 0 {
+		out = "…" + out
+	}
+	if start+n < len(runes) {
+		out += "…"
+	}
+
+	return out
+}
+
+type cloudTag struct {
+	Name string
+	Size int
+}
+
+// tagCloud assigns each tag a size from 1 to 5 relative to the most used
+// tag, for use as a CSS class.
+func tagCloud(tags []*models.Tag) []cloudTag {
+	most := 0
+	for _, t := range tags {
+		most = max(most, t.Count)
+	}
+
+	cloud := make([]cloudTag, 0, len(tags))
+	for _, t := range tags {
+		cloud = append(cloud, cloudTag{
+			Name: t.Name,
+			Size: 1 + (t.Count*4)/most,
+		})
+	}
+
+	slices.SortFunc(cloud, func(a, b cloudTag) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return cloud
+}
+
+// highlightCode renders content with syntax highlighting, falling back to
+// the plain escaped content if the highlighter fails.
+func highlightCode(content, language string) template.HTML {
+	html, err := syntax.HTML(content, language)
+	if err != nil {
+		return template.HTML(template.HTMLEscapeString(content))
+	}
+	return html
+}
+
 var functions = template.FuncMap{
 	"humanDate": humanDate,
+	"highlight": highlight,
+	"excerpt":   excerpt,
+	"tagCloud":  tagCloud,
+
+	"highlightCode": highlightCode,
+	"languages":     func() []syntax.Language { return syntax.Languages },
+	"languageLabel": syntax.Label,
 }
@@ -37,3 +37,87 @@ func TestHumanDate(t *testing.T) {
 		})
 	}
 }
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name  string
+		s     string
+		query string
+		want  string
+	}{
+		{
+			name:  "Single word",
+			s:     "An old silent pond",
+			query: "pond",
+			want:  "An old silent <mark>pond</mark>",
+		},
+		{
+			name:  "Case insensitive, several words",
+			s:     "An Old silent pond",
+			query: "old POND",
+			want:  "An <mark>Old</mark> silent <mark>pond</mark>",
+		},
+		{
+			name:  "Escapes HTML",
+			s:     "<b>regex</b>",
+			query: "regex",
+			want:  "&lt;b&gt;<mark>regex</mark>&lt;/b&gt;",
+		},
+		{
+			name:  "Regexp metacharacters in query",
+			s:     "a.b axb",
+			query: "a.b",
+			want:  "<mark>a.b</mark> axb",
+		},
+		{
+			name:  "Empty query",
+			s:     "<pond>",
+			query: "",
+			want:  "&lt;pond&gt;",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, string(highlight(tt.s, tt.query)), tt.want)
+		})
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	tests := []struct {
+		name  string
+		s     string
+		query string
+		n     int
+		want  string
+	}{
+		{
+			name:  "Short",
+			s:     "An old silent pond",
+			query: "pond",
+			n:     50,
+			want:  "An old silent pond",
+		},
+		{
+			name:  "Centred on match",
+			s:     "aaaaaaaaaa pond bbbbbbbbbb",
+			query: "pond",
+			n:     8,
+			want:  "…aaa pond…",
+		},
+		{
+			name:  "No match",
+			s:     "aaaaaaaaaa",
+			query: "pond",
+			n:     4,
+			want:  "aaaa…",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, excerpt(tt.s, tt.query, tt.n), tt.want)
+		})
+	}
+}
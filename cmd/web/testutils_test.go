@@ -10,7 +10,10 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"regexp"
+	"strings"
 	"testing"
+	"thienel/lets-go/internal/lockout"
+	"thienel/lets-go/internal/mailer"
 	"thienel/lets-go/internal/models/mocks"
 	"time"
 
@@ -36,19 +39,36 @@ func newTestApplication(t *testing.T) *application {
 	}
 
 	formDecoder := form.NewDecoder()
+	loginAttempts := &lockout.Memory{}
 
 	sessionManager := scs.New()
 	sessionManager.Lifetime = 12 * time.Hour
 	sessionManager.Cookie.Secure = true
 
 	return &application{
-		errorLog:       log.New(io.Discard, "", 0),
-		infoLog:        log.New(io.Discard, "", 0),
-		snippets:       &mocks.SnippetModel{},
-		users:          &mocks.UserModel{},
-		templateCache:  templateCache,
-		formDecoder:    formDecoder,
-		sessionManager: sessionManager,
+		errorLog:           log.New(io.Discard, "", 0),
+		infoLog:            log.New(io.Discard, "", 0),
+		snippets:           &mocks.SnippetModel{},
+		users:              &mocks.UserModel{},
+		tokens:             &mocks.TokenModel{},
+		passwordResets:     &mocks.PasswordResetModel{},
+		verifications:      &mocks.EmailVerificationModel{},
+		twoFactor:          &mocks.TwoFactorModel{},
+		accountUnlocks:     &mocks.AccountUnlockModel{},
+		audit:              &mocks.AuditModel{},
+		userSessions:       &mocks.UserSessionModel{},
+		mailer:             &mailer.Memory{},
+		templateCache:      templateCache,
+		formDecoder:        formDecoder,
+		sessionManager:     sessionManager,
+		accountGuard:       lockout.New(loginAttempts, accountLoginPolicy),
+		ipGuard:            lockout.New(loginAttempts, ipLoginPolicy),
+		twoFactorGuard:     lockout.New(loginAttempts, twoFactorLoginPolicy),
+		snippetUnlockGuard: lockout.New(loginAttempts, snippetUnlockPolicy),
+		resetEmailGuard:    lockout.New(loginAttempts, resetEmailPolicy),
+		resetIPGuard:       lockout.New(loginAttempts, resetIPPolicy),
+		verifyResendGuard:  lockout.New(loginAttempts, verifyResendPolicy),
+		baseURL:            "https://snippets.example.com",
 	}
 }
 
@@ -72,6 +92,17 @@ func newTestServer(t *testing.T, h http.Handler) *testServer {
 	return &testServer{ts}
 }
 
+// resetCookies starts a new browser session, as if the user had closed
+// their browser.
+func (ts *testServer) resetCookies(t *testing.T) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts.Client().Jar = jar
+}
+
 func (ts *testServer) get(t *testing.T, urlPath string) (int, http.Header, string) {
 	rs, err := ts.Client().Get(ts.URL + urlPath)
 	if err != nil {
@@ -103,3 +134,44 @@ func (ts *testServer) postForm(t *testing.T, urlPath string, form url.Values) (i
 
 	return rs.StatusCode, rs.Header, string(body)
 }
+
+// request sends a request with the given headers and body, for tests of
+// the JSON API.
+func (ts *testServer) request(t *testing.T, method, urlPath string,
+	header http.Header, body string) (int, http.Header, string) {
+	req, err := http.NewRequest(method, ts.URL+urlPath, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rs.Body.Close()
+	rsBody, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rs.StatusCode, rs.Header, string(rsBody)
+}
+
+func (ts *testServer) login(t *testing.T, email, password string) {
+	_, _, body := ts.get(t, "/user/login")
+	csrfToken := extractCSRFToken(t, body)
+
+	form := url.Values{}
+	form.Add("email", email)
+	form.Add("password", password)
+	form.Add("csrf_token", csrfToken)
+
+	code, _, _ := ts.postForm(t, "/user/login", form)
+	if code != http.StatusSeeOther {
+		t.Fatalf("login failed with status %d", code)
+	}
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"image/png"
+	"net/http"
+	"strconv"
+	"strings"
+	"thienel/lets-go/internal/lockout"
+	"thienel/lets-go/internal/models"
+	"thienel/lets-go/internal/validator"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+// totpIssuer names the site in authenticator apps.
+const totpIssuer = "Snippetbox"
+
+// totpPeriod is the length of a TOTP time step in seconds, as recommended by
+// RFC 6238.
+const totpPeriod = 30
+
+// twoFactorLoginTTL is how long a user has to enter their code after giving
+// the right password.
+const twoFactorLoginTTL = 5 * time.Minute
+
+// twoFactorLoginPolicy locks a user's second login step for a while after
+// five wrong codes, so that the six-digit codes can't be guessed.
+var twoFactorLoginPolicy = lockout.Policy{
+	Free:      5,
+	LockAfter: 5,
+	LockFor:   15 * time.Minute,
+}
+
+func twoFactorLoginKey(userId int) string {
+	return "2fa:" + strconv.Itoa(userId)
+}
+
+var totpOpts = totp.ValidateOpts{
+	Period:    totpPeriod,
+	Digits:    otp.DigitsSix,
+	Algorithm: otp.AlgorithmSHA1,
+}
+
+// totpStep returns the time step that code belongs to if it is the right
+// code for secret at now, allowing for one step of clock drift either way.
+func totpStep(secret, code string, now time.Time) (int64, bool) {
+	for _, skew := range []int64{0, -1, 1} {
+		t := now.Add(time.Duration(skew*totpPeriod) * time.Second)
+
+		want, err := totp.GenerateCodeCustom(secret, t, totpOpts)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(want), []byte(code)) == 1 {
+			return t.Unix() / totpPeriod, true
+		}
+	}
+
+	return 0, false
+}
+
+// isTOTPCode reports whether code looks like a code from an authenticator
+// app rather than a recovery code.
+func isTOTPCode(code string) bool {
+	if len(code) != 6 {
+		return false
+	}
+	_, err := strconv.Atoi(code)
+	return err == nil
+}
+
+// checkSecondFactor checks a code entered by the user, which may be either
+// the current code from their authenticator app or one of their recovery
+// codes. Either kind can only be used once. It reports whether a recovery
+// code was used and returns models.ErrInvalidCredentials if the code is
+// wrong, or models.ErrNoRecord if the user has turned two-factor
+// authentication off since giving their password.
+func (app *application) checkSecondFactor(userId int, code string) (bool, error) {
+	code = strings.ReplaceAll(code, " ", "")
+
+	if !isTOTPCode(code) {
+		return true, app.twoFactor.UseRecoveryCode(userId, code)
+	}
+
+	secret, err := app.twoFactor.Secret(userId)
+	if err != nil {
+		return false, err
+	}
+
+	step, ok := totpStep(secret, code, time.Now())
+	if !ok {
+		return false, models.ErrInvalidCredentials
+	}
+
+	return false, app.twoFactor.UseStep(userId, step)
+}
+
+// enrollmentKey returns the TOTP key the user is setting up. It is kept in
+// the session until the user confirms it with a code, so that reloading the
+// page doesn't change the secret under them.
+func (app *application) enrollmentKey(r *http.Request, user *models.User) (*otp.Key, error) {
+	uri := app.sessionManager.GetString(r.Context(), "totpEnrollURL")
+	if uri != "" {
+		return otp.NewKeyFromURL(uri)
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      totpIssuer,
+		AccountName: user.Email,
+		Period:      totpPeriod,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	app.sessionManager.Put(r.Context(), "totpEnrollURL", key.URL())
+
+	return key, nil
+}
+
+// twoFactorData loads everything the two-factor settings page shows. If it
+// returns false a response has already been written.
+func (app *application) twoFactorData(w http.ResponseWriter, r *http.Request) (*templateData, bool) {
+	user, err := app.users.Get(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, err)
+		return nil, false
+	}
+
+	data := app.newTemplateData(r)
+	data.Account = user
+
+	// The recovery codes are only ever shown on the page load after
+	// two-factor authentication is turned on.
+	data.RecoveryCodes, _ = app.sessionManager.Pop(r.Context(),
+		"recoveryCodes").([]string)
+
+	if user.TwoFactorEnabled {
+		data.RecoveryCodesLeft, err = app.twoFactor.RecoveryCodesLeft(user.Id)
+		if err != nil {
+			app.serverError(w, err)
+			return nil, false
+		}
+	} else {
+		key, err := app.enrollmentKey(r, user)
+		if err != nil {
+			app.serverError(w, err)
+			return nil, false
+		}
+		data.TOTPSecret = key.Secret()
+	}
+
+	return data, true
+}
+
+type twoFactorForm struct {
+	Code                string `form:"code"`
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) accountTwoFactor(w http.ResponseWriter, r *http.Request) {
+	data, ok := app.twoFactorData(w, r)
+	if !ok {
+		return
+	}
+	data.Form = twoFactorForm{}
+
+	app.render(w, http.StatusOK, "twoFactor.html", data)
+}
+
+// accountTwoFactorQR serves the QR code of the key being set up. It is a
+// separate image, rather than a data: URL, because the Content-Security-Policy
+// only allows images from this site.
+func (app *application) accountTwoFactorQR(w http.ResponseWriter, r *http.Request) {
+	uri := app.sessionManager.GetString(r.Context(), "totpEnrollURL")
+	if uri == "" {
+		app.notFound(w)
+		return
+	}
+
+	key, err := otp.NewKeyFromURL(uri)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	img, err := key.Image(240, 240)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	err = png.Encode(buf, img)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	buf.WriteTo(w)
+}
+
+func (app *application) accountTwoFactorEnablePost(w http.ResponseWriter, r *http.Request) {
+	var form twoFactorForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	userId := app.authenticatedUserID(r)
+
+	user, err := app.users.Get(userId)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// A key left over in the session must not replace the secret and
+	// recovery codes of a user who already has two-factor authentication
+	// on, without their password. They have to turn it off first.
+	if user.TwoFactorEnabled {
+		app.sessionManager.Remove(r.Context(), "totpEnrollURL")
+		app.sessionManager.Put(r.Context(), "flash",
+			"Two-factor authentication is already on")
+		http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+		return
+	}
+
+	uri := app.sessionManager.GetString(r.Context(), "totpEnrollURL")
+	if uri == "" {
+		http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+		return
+	}
+
+	key, err := otp.NewKeyFromURL(uri)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	code := strings.ReplaceAll(form.Code, " ", "")
+	form.CheckField(validator.NotBlank(code), "code", "This field cannot be blank")
+
+	var step int64
+	if form.Valid() {
+		var ok bool
+		step, ok = totpStep(key.Secret(), code, time.Now())
+		form.CheckField(ok, "code", "Code is incorrect")
+	}
+
+	if !form.Valid() {
+		data, ok := app.twoFactorData(w, r)
+		if !ok {
+			return
+		}
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "twoFactor.html", data)
+		return
+	}
+
+	// The code just entered can't be used again to log in.
+	codes, err := app.twoFactor.Enable(userId, key.Secret(), step)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Remove(r.Context(), "totpEnrollURL")
+	app.sessionManager.Put(r.Context(), "recoveryCodes", codes)
+	app.sessionManager.Put(r.Context(), "flash", "Two-factor authentication is on")
+
+	http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+}
+
+func (app *application) accountTwoFactorDisablePost(w http.ResponseWriter, r *http.Request) {
+	var form twoFactorForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	userId := app.authenticatedUserID(r)
+
+	form.CheckField(validator.NotBlank(form.Password), "password",
+		"This field cannot be blank")
+
+	if form.Valid() {
+		err = app.users.IsCorrectPassword(userId, form.Password)
+		if err != nil {
+			if errors.Is(err, models.ErrInvalidCredentials) {
+				form.AddFieldError("password", "Password is incorrect")
+			} else {
+				app.serverError(w, err)
+				return
+			}
+		}
+	}
+
+	if !form.Valid() {
+		data, ok := app.twoFactorData(w, r)
+		if !ok {
+			return
+		}
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "twoFactor.html", data)
+		return
+	}
+
+	err = app.twoFactor.Disable(userId)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Two-factor authentication is off")
+
+	http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+}
+
+// pendingTwoFactorUser returns the id of the user who has given the right
+// password but not yet their second factor, or 0 if there is none or they
+// took too long.
+func (app *application) pendingTwoFactorUser(r *http.Request) int {
+	id := app.sessionManager.GetInt(r.Context(), "twoFactorUserID")
+	expires := app.sessionManager.GetInt64(r.Context(), "twoFactorExpires")
+	if id == 0 || time.Now().Unix() > expires {
+		return 0
+	}
+
+	return id
+}
+
+func (app *application) expiredTwoFactorLogin(w http.ResponseWriter, r *http.Request) {
+	app.sessionManager.Put(r.Context(), "flash",
+		"Your login has timed out, please log in again")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+func (app *application) userLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if app.pendingTwoFactorUser(r) == 0 {
+		app.expiredTwoFactorLogin(w, r)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = twoFactorForm{}
+	app.render(w, http.StatusOK, "loginTwoFactor.html", data)
+}
+
+func (app *application) userLoginTwoFactorPost(w http.ResponseWriter, r *http.Request) {
+	var form twoFactorForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	id := app.pendingTwoFactorUser(r)
+	if id == 0 {
+		app.expiredTwoFactorLogin(w, r)
+		return
+	}
+
+	data := app.newTemplateData(r)
+
+	form.CheckField(validator.NotBlank(form.Code), "code", "This field cannot be blank")
+	if !form.Valid() {
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "loginTwoFactor.html", data)
+		return
+	}
+
+	// The attempt is counted before the code is checked, so that codes
+	// can't be guessed in parallel.
+	key := twoFactorLoginKey(id)
+	res, err := app.twoFactorGuard.Reserve(key)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if !res.Allowed() {
+		form.AddNonFieldError("Too many incorrect codes, please try again later")
+		data.Form = form
+		app.render(w, http.StatusTooManyRequests, "loginTwoFactor.html", data)
+		return
+	}
+
+	recovery, err := app.checkSecondFactor(id, form.Code)
+	if errors.Is(err, models.ErrInvalidCredentials) {
+		form.AddFieldError("code", "Code is incorrect")
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "loginTwoFactor.html", data)
+		return
+	}
+	if err != nil {
+		// Only wrong codes count against the user.
+		releaseErr := app.twoFactorGuard.Release(key, res)
+
+		switch {
+		case releaseErr != nil:
+			app.serverError(w, errors.Join(err, releaseErr))
+		case errors.Is(err, models.ErrNoRecord):
+			// Two-factor authentication was turned off after the
+			// password was given, so the login has to start again.
+			app.sessionManager.Remove(r.Context(), "twoFactorUserID")
+			app.sessionManager.Remove(r.Context(), "twoFactorExpires")
+			app.expiredTwoFactorLogin(w, r)
+		default:
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	err = app.twoFactorGuard.Reset(key)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	flash := "You've been logged in successfully"
+	if recovery {
+		left, err := app.twoFactor.RecoveryCodesLeft(id)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		flash = fmt.Sprintf("You've been logged in with a recovery code. You have %d left", left)
+	}
+
+	app.sessionManager.Remove(r.Context(), "twoFactorUserID")
+	app.sessionManager.Remove(r.Context(), "twoFactorExpires")
+
+	app.logIn(w, r, id, flash)
+}
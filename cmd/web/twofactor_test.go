@@ -0,0 +1,357 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"thienel/lets-go/internal/assert"
+	"thienel/lets-go/internal/lockout"
+	"thienel/lets-go/internal/models"
+	"thienel/lets-go/internal/models/mocks"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+)
+
+func TestTOTPStep(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	step := now.Unix() / totpPeriod
+
+	codeAt := func(t *testing.T, at time.Time) string {
+		code, err := totp.GenerateCodeCustom(mocks.MockTOTPSecret, at, totpOpts)
+		assert.NilErr(t, err)
+		return code
+	}
+
+	tests := []struct {
+		name     string
+		at       time.Time
+		wantOK   bool
+		wantStep int64
+	}{
+		{"Current step", now, true, step},
+		{"Previous step", now.Add(-totpPeriod * time.Second), true, step - 1},
+		{"Next step", now.Add(totpPeriod * time.Second), true, step + 1},
+		{"Too old", now.Add(-3 * totpPeriod * time.Second), false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := totpStep(mocks.MockTOTPSecret, codeAt(t, tt.at), now)
+
+			assert.Equal(t, ok, tt.wantOK)
+			assert.Equal(t, got, tt.wantStep)
+		})
+	}
+}
+
+// startTwoFactorLogin logs in as Dave, who has two-factor authentication
+// on, as far as the second step.
+func startTwoFactorLogin(t *testing.T, ts *testServer) string {
+	_, _, body := ts.get(t, "/user/login")
+
+	form := url.Values{}
+	form.Add("email", "dave@example.com")
+	form.Add("password", "pa$$word")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, header, _ := ts.postForm(t, "/user/login", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/user/login/2fa")
+
+	code, _, body = ts.get(t, "/user/login/2fa")
+	assert.Equal(t, code, http.StatusOK)
+
+	return extractCSRFToken(t, body)
+}
+
+func TestUserLoginTwoFactor(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	t.Run("No pending login", func(t *testing.T) {
+		code, header, _ := ts.get(t, "/user/login/2fa")
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/user/login")
+	})
+
+	validCode, err := totp.GenerateCode(mocks.MockTOTPSecret, time.Now())
+	assert.NilErr(t, err)
+
+	tests := []struct {
+		name         string
+		code         string
+		wantCode     int
+		wantLocation string
+		wantBody     string
+		wantFlash    string
+	}{
+		{
+			name:     "Blank code",
+			code:     "",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This field cannot be blank",
+		},
+		{
+			name:     "Wrong code",
+			code:     "000000",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "Code is incorrect",
+		},
+		{
+			name:     "Wrong recovery code",
+			code:     "aaaaa-aaaaa",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "Code is incorrect",
+		},
+		{
+			name:         "Valid code",
+			code:         validCode[:3] + " " + validCode[3:],
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/account/view",
+			wantFlash:    "You&#39;ve been logged in successfully",
+		},
+		{
+			name:         "Recovery code",
+			code:         mocks.MockRecoveryCode,
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/account/view",
+			wantFlash:    "You&#39;ve been logged in with a recovery code. You have 9 left",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts.resetCookies(t)
+
+			csrfToken := startTwoFactorLogin(t, ts)
+
+			// Until the second step is done, the user isn't logged in. The
+			// page they tried to reach is where they end up afterwards.
+			code, header, _ := ts.get(t, "/account/view")
+			assert.Equal(t, code, http.StatusSeeOther)
+			assert.Equal(t, header.Get("Location"), "/user/login")
+
+			form := url.Values{}
+			form.Add("code", tt.code)
+			form.Add("csrf_token", csrfToken)
+
+			code, header, body := ts.postForm(t, "/user/login/2fa", form)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, header.Get("Location"), tt.wantLocation)
+			assert.StringContains(t, body, tt.wantBody)
+
+			if tt.wantFlash != "" {
+				code, _, body := ts.get(t, "/account/view")
+				assert.Equal(t, code, http.StatusOK)
+				assert.StringContains(t, body, tt.wantFlash)
+			}
+		})
+	}
+
+	t.Run("Too many wrong codes", func(t *testing.T) {
+		ts.resetCookies(t)
+		csrfToken := startTwoFactorLogin(t, ts)
+
+		form := url.Values{}
+		form.Add("code", "000000")
+		form.Add("csrf_token", csrfToken)
+
+		for range 5 {
+			code, _, _ := ts.postForm(t, "/user/login/2fa", form)
+			assert.Equal(t, code, http.StatusUnprocessableEntity)
+		}
+
+		form.Set("code", validCode)
+		code, _, body := ts.postForm(t, "/user/login/2fa", form)
+		assert.Equal(t, code, http.StatusTooManyRequests)
+		assert.StringContains(t, body, "Too many incorrect codes")
+	})
+}
+
+// disabledTwoFactor is Dave's two-factor model after he has turned it off.
+type disabledTwoFactor struct {
+	mocks.TwoFactorModel
+}
+
+func (m *disabledTwoFactor) Secret(userId int) (string, error) {
+	return "", models.ErrNoRecord
+}
+
+func TestUserLoginTwoFactorDisabled(t *testing.T) {
+	app := newTestApplication(t)
+	store := &lockout.Memory{}
+	app.twoFactorGuard = lockout.New(store, twoFactorLoginPolicy)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	csrfToken := startTwoFactorLogin(t, ts)
+
+	// Dave turns two-factor authentication off in another session before
+	// entering his code.
+	app.twoFactor = &disabledTwoFactor{}
+
+	validCode, err := totp.GenerateCode(mocks.MockTOTPSecret, time.Now())
+	assert.NilErr(t, err)
+
+	form := url.Values{"code": {validCode}, "csrf_token": {csrfToken}}
+	code, header, _ := ts.postForm(t, "/user/login/2fa", form)
+
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/user/login")
+
+	code, header, _ = ts.get(t, "/user/login/2fa")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/user/login")
+
+	// The code wasn't wrong, so it doesn't count against Dave.
+	rec, err := store.Get(twoFactorLoginKey(5))
+	assert.NilErr(t, err)
+	assert.Equal(t, rec, lockout.Record{})
+}
+
+// totpSecret returns the secret shown on the two-factor settings page.
+func totpSecret(t *testing.T, body string) string {
+	matches := regexp.MustCompile(`<code class="totp-secret">([A-Z2-7]+)</code>`).
+		FindStringSubmatch(body)
+	if len(matches) < 2 {
+		t.Fatal("no TOTP secret found in body")
+	}
+
+	return matches[1]
+}
+
+// twoFactorUsers is the user model after Alice has turned on two-factor
+// authentication.
+type twoFactorUsers struct {
+	mocks.UserModel
+}
+
+func (m *twoFactorUsers) Get(id int) (*models.User, error) {
+	user, err := m.UserModel.Get(id)
+	if err == nil && id == 1 {
+		user.TwoFactorEnabled = true
+	}
+	return user, err
+}
+
+func TestAccountTwoFactor(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		code, header, _ := ts.get(t, "/account/2fa")
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/user/login")
+	})
+
+	ts.login(t, "alice@example.com", "pa$$word")
+
+	code, _, body := ts.get(t, "/account/2fa")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, `<img
+  src="/account/2fa/qr.png"`)
+	csrfToken := extractCSRFToken(t, body)
+
+	secret := totpSecret(t, body)
+
+	// The secret stays the same until it is confirmed.
+	_, _, body = ts.get(t, "/account/2fa")
+	assert.StringContains(t, body, secret)
+
+	t.Run("QR code", func(t *testing.T) {
+		code, header, body := ts.get(t, "/account/2fa/qr.png")
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, header.Get("Content-Type"), "image/png")
+		assert.Equal(t, body[:4], "\x89PNG")
+	})
+
+	t.Run("Wrong code", func(t *testing.T) {
+		form := url.Values{"code": {"000000"}, "csrf_token": {csrfToken}}
+		code, _, body := ts.postForm(t, "/account/2fa/enable", form)
+
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+		assert.StringContains(t, body, "Code is incorrect")
+		assert.StringContains(t, body, secret)
+	})
+
+	t.Run("Enable", func(t *testing.T) {
+		valid, err := totp.GenerateCode(secret, time.Now())
+		assert.NilErr(t, err)
+
+		form := url.Values{"code": {valid}, "csrf_token": {csrfToken}}
+		code, header, _ := ts.postForm(t, "/account/2fa/enable", form)
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/account/2fa")
+
+		_, _, body := ts.get(t, "/account/2fa")
+		assert.StringContains(t, body, "Two-factor authentication is on")
+		assert.StringContains(t, body, "<code>"+mocks.MockRecoveryCode+"</code>")
+
+		// The codes are only shown once.
+		_, _, body = ts.get(t, "/account/2fa")
+		if strings.Contains(body, mocks.MockRecoveryCode) {
+			t.Error("recovery codes shown twice")
+		}
+	})
+
+	t.Run("Already on", func(t *testing.T) {
+		// Alice has turned two-factor authentication on in another
+		// session, with a different key, so the one in this session is
+		// stale.
+		_, _, body := ts.get(t, "/account/2fa")
+		secret := totpSecret(t, body)
+
+		app.users = &twoFactorUsers{}
+		defer func() { app.users = &mocks.UserModel{} }()
+
+		valid, err := totp.GenerateCode(secret, time.Now())
+		assert.NilErr(t, err)
+
+		form := url.Values{"code": {valid}, "csrf_token": {csrfToken}}
+		code, header, _ := ts.postForm(t, "/account/2fa/enable", form)
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/account/2fa")
+
+		_, _, body = ts.get(t, "/account/2fa")
+		assert.StringContains(t, body, "Two-factor authentication is already on")
+		if strings.Contains(body, mocks.MockRecoveryCode) {
+			t.Error("recovery codes replaced")
+		}
+	})
+
+	t.Run("Disable", func(t *testing.T) {
+		ts.resetCookies(t)
+		csrfToken := startTwoFactorLogin(t, ts)
+
+		valid, err := totp.GenerateCode(mocks.MockTOTPSecret, time.Now())
+		assert.NilErr(t, err)
+		ts.postForm(t, "/user/login/2fa",
+			url.Values{"code": {valid}, "csrf_token": {csrfToken}})
+
+		code, _, body := ts.get(t, "/account/2fa")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "You have 9 recovery")
+
+		form := url.Values{"password": {""}, "csrf_token": {csrfToken}}
+		code, _, body = ts.postForm(t, "/account/2fa/disable", form)
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+		assert.StringContains(t, body, "This field cannot be blank")
+
+		form.Set("password", "pa$$word")
+		code, header, _ := ts.postForm(t, "/account/2fa/disable", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/account/2fa")
+	})
+}
@@ -3,16 +3,20 @@ module thienel/lets-go
 go 1.24.4
 
 require (
+	github.com/alecthomas/chroma/v2 v2.14.0
 	github.com/alexedwards/scs/mysqlstore v0.0.0-20250417082927-ab20b3feb5e9
 	github.com/alexedwards/scs/v2 v2.8.0
 	github.com/go-playground/form/v4 v4.2.1
 	github.com/go-sql-driver/mysql v1.9.3
 	github.com/justinas/nosurf v1.1.1
+	github.com/pquerna/otp v1.5.0
 	golang.org/x/crypto v0.39.0
 )
 
 require (
 	filippo.io/edwards25519 v1.1.0 // indirect
+	github.com/boombuler/barcode v1.0.1-0.20190219062509-6c824513bacc // indirect
+	github.com/dlclark/regexp2 v1.11.0 // indirect
 	github.com/julienschmidt/httprouter v1.3.0
 	github.com/justinas/alice v1.2.0
 )
@@ -0,0 +1,191 @@
+// Package client talks to a snippetbox server over its JSON API. It is used
+// by the snippet command-line tool.
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"thienel/lets-go/internal/models"
+	"time"
+)
+
+// Error is an error response from the API.
+type Error struct {
+	StatusCode  int
+	Message     string            `json:"error"`
+	FieldErrors map[string]string `json:"field_errors"`
+}
+
+func (e *Error) Error() string {
+	if len(e.FieldErrors) == 0 {
+		return e.Message
+	}
+
+	fields := make([]string, 0, len(e.FieldErrors))
+	for field, msg := range e.FieldErrors {
+		fields = append(fields, field+": "+msg)
+	}
+	slices.Sort(fields)
+
+	return e.Message + " (" + strings.Join(fields, "; ") + ")"
+}
+
+type Client struct {
+	// BaseURL is the server's address, such as "https://localhost:4000".
+	BaseURL string
+	// Token is a personal API token. Requests are anonymous without one.
+	Token      string
+	HTTPClient *http.Client
+}
+
+func New(baseURL, token string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		Token:      token,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// SnippetURL returns the address at which a snippet can be viewed in a
+// browser.
+func (c *Client) SnippetURL(slug string) string {
+	return c.BaseURL + "/s/" + slug
+}
+
+// SnippetList is a page of snippets from List. Next and Prev are cursors
+// for the neighbouring pages, or empty if there are none.
+type SnippetList struct {
+	Snippets []*models.Snippet `json:"snippets"`
+	Next     string            `json:"next"`
+	Prev     string            `json:"prev"`
+}
+
+// List returns public snippets, newest first, starting after the given
+// cursor. An empty cursor starts at the newest snippet and a limit of 0
+// uses the server's default.
+func (c *Client) List(after string, limit int) (*SnippetList, error) {
+	v := url.Values{}
+	if after != "" {
+		v.Set("after", after)
+	}
+	if limit > 0 {
+		v.Set("limit", strconv.Itoa(limit))
+	}
+
+	var list SnippetList
+	err := c.do(http.MethodGet, "/api/v1/snippets", v, nil, &list)
+	if err != nil {
+		return nil, err
+	}
+
+	return &list, nil
+}
+
+// SearchResults is a page of results from Search. NextPage is 0 on the
+// last page.
+type SearchResults struct {
+	Snippets []*models.Snippet `json:"snippets"`
+	NextPage int               `json:"next_page"`
+}
+
+// Search returns the given 1-based page of public snippets matching query.
+func (c *Client) Search(query string, page int) (*SearchResults, error) {
+	v := url.Values{}
+	v.Set("q", query)
+	v.Set("page", strconv.Itoa(page))
+
+	var results SearchResults
+	err := c.do(http.MethodGet, "/api/v1/search", v, nil, &results)
+	if err != nil {
+		return nil, err
+	}
+
+	return &results, nil
+}
+
+// Get returns a single snippet, including its content.
+func (c *Client) Get(slug string) (*models.Snippet, error) {
+	var data struct {
+		Snippet *models.Snippet `json:"snippet"`
+	}
+	err := c.do(http.MethodGet, "/api/v1/snippets/"+url.PathEscape(slug), nil,
+		nil, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	return data.Snippet, nil
+}
+
+// Create stores a new snippet and returns it. It needs a token with the
+// write scope.
+func (c *Client) Create(in *models.SnippetInput) (*models.Snippet, error) {
+	var data struct {
+		Snippet *models.Snippet `json:"snippet"`
+	}
+	err := c.do(http.MethodPost, "/api/v1/snippets", nil, in, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	return data.Snippet, nil
+}
+
+// do sends a request with body, if any, encoded as JSON and decodes the
+// response into dst. Error responses are returned as *Error.
+func (c *Client) do(method, path string, query url.Values, body any, dst any) error {
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var r io.Reader
+	if body != nil {
+		js, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(js)
+	}
+
+	req, err := http.NewRequest(method, u, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	rs, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rs.Body.Close()
+
+	if rs.StatusCode >= 400 {
+		apiErr := &Error{StatusCode: rs.StatusCode}
+		err = json.NewDecoder(rs.Body).Decode(apiErr)
+		if err != nil || apiErr.Message == "" {
+			apiErr.Message = rs.Status
+		}
+		return apiErr
+	}
+
+	err = json.NewDecoder(rs.Body).Decode(dst)
+	if err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// DefaultURL is the server used when none has been configured.
+const DefaultURL = "https://localhost:4000"
+
+// Config is what the command-line tool remembers between runs.
+type Config struct {
+	URL   string `json:"url"`
+	Token string `json:"token,omitempty"`
+}
+
+// DefaultConfigPath returns the location of the config file in the user's
+// configuration directory, e.g. ~/.config/snippetbox/config.json on Linux.
+func DefaultConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "snippetbox", "config.json"), nil
+}
+
+// LoadConfig reads the config file at path. A missing file is not an
+// error; the defaults are returned instead.
+func LoadConfig(path string) (*Config, error) {
+	cfg := &Config{URL: DefaultURL}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return cfg, nil
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal(b, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Save writes the config to path. The file holds an API token, so only its
+// owner may read it.
+func (c *Config) Save(path string) error {
+	err := os.MkdirAll(filepath.Dir(path), 0o700)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(b, '\n'), 0o600)
+}
@@ -0,0 +1,33 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"thienel/lets-go/internal/assert"
+)
+
+func TestConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snippetbox", "config.json")
+
+	t.Run("Missing file", func(t *testing.T) {
+		cfg, err := LoadConfig(path)
+		assert.NilErr(t, err)
+		assert.Equal(t, cfg.URL, DefaultURL)
+		assert.Equal(t, cfg.Token, "")
+	})
+
+	t.Run("Round trip", func(t *testing.T) {
+		want := &Config{URL: "https://snippets.example.com", Token: "sb_c2VjcmV0"}
+		err := want.Save(path)
+		assert.NilErr(t, err)
+
+		info, err := os.Stat(path)
+		assert.NilErr(t, err)
+		assert.Equal(t, info.Mode().Perm(), os.FileMode(0o600))
+
+		got, err := LoadConfig(path)
+		assert.NilErr(t, err)
+		assert.Equal(t, *got, *want)
+	})
+}
@@ -0,0 +1,222 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Op int
+
+const (
+	Equal Op = iota
+	Delete
+	Insert
+)
+
+func (op Op) String() string {
+	switch op {
+	case Delete:
+		return "delete"
+	case Insert:
+		return "insert"
+	default:
+		return "equal"
+	}
+}
+
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// Prefix returns the character used for the line in unified diff output.
+func (l Line) Prefix() string {
+	switch l.Op {
+	case Delete:
+		return "-"
+	case Insert:
+		return "+"
+	default:
+		return " "
+	}
+}
+
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Lines    []Line
+}
+
+// Header returns the "@@ -a,b +c,d @@" range line for the hunk.
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines,
+		h.NewStart, h.NewLines)
+}
+
+// maxCells bounds the size of the LCS table. Inputs whose differing middle
+// section is larger than this are diffed as a full replacement.
+const maxCells = 4_000_000
+
+// Lines returns the line-by-line edit script that turns a into b.
+func Lines(a, b string) []Line {
+	x, y := splitLines(a), splitLines(b)
+
+	prefix := 0
+	for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(x)-prefix && suffix < len(y)-prefix &&
+		x[len(x)-1-suffix] == y[len(y)-1-suffix] {
+		suffix++
+	}
+
+	lines := make([]Line, 0, len(x)+len(y))
+	for _, text := range x[:prefix] {
+		lines = append(lines, Line{Equal, text})
+	}
+
+	lines = append(lines, middle(x[prefix:len(x)-suffix], y[prefix:len(y)-suffix])...)
+
+	for _, text := range x[len(x)-suffix:] {
+		lines = append(lines, Line{Equal, text})
+	}
+
+	return lines
+}
+
+func middle(x, y []string) []Line {
+	n, m := len(x), len(y)
+	lines := make([]Line, 0, n+m)
+
+	if (n+1)*(m+1) > maxCells {
+		for _, text := range x {
+			lines = append(lines, Line{Delete, text})
+		}
+		for _, text := range y {
+			lines = append(lines, Line{Insert, text})
+		}
+		return lines
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of x[i:]
+	// and y[j:].
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case x[i] == y[j]:
+			lines = append(lines, Line{Equal, x[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, Line{Delete, x[i]})
+			i++
+		default:
+			lines = append(lines, Line{Insert, y[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		lines = append(lines, Line{Delete, x[i]})
+	}
+	for ; j < m; j++ {
+		lines = append(lines, Line{Insert, y[j]})
+	}
+
+	return lines
+}
+
+// Unified groups the edit script from a to b into hunks, keeping context
+// unchanged lines around each change. It returns nil if a and b are equal.
+func Unified(a, b string, context int) []Hunk {
+	lines := Lines(a, b)
+
+	// oldNo[i] and newNo[i] are the 1-based line numbers lines[i] would have
+	// in a and b respectively.
+	oldNo := make([]int, len(lines))
+	newNo := make([]int, len(lines))
+	var changes []int
+	o, n := 1, 1
+	for i, line := range lines {
+		oldNo[i], newNo[i] = o, n
+		switch line.Op {
+		case Equal:
+			o++
+			n++
+		case Delete:
+			o++
+			changes = append(changes, i)
+		case Insert:
+			n++
+			changes = append(changes, i)
+		}
+	}
+
+	var hunks []Hunk
+	for len(changes) > 0 {
+		first, last := changes[0], changes[0]
+		k := 1
+		for k < len(changes) && changes[k]-last <= 2*context {
+			last = changes[k]
+			k++
+		}
+		changes = changes[k:]
+
+		start := max(first-context, 0)
+		end := min(last+context+1, len(lines))
+
+		h := Hunk{
+			OldStart: oldNo[start],
+			NewStart: newNo[start],
+			Lines:    lines[start:end],
+		}
+		for _, line := range h.Lines {
+			if line.Op != Insert {
+				h.OldLines++
+			}
+			if line.Op != Delete {
+				h.NewLines++
+			}
+		}
+
+		// An empty range is addressed by the line before it.
+		if h.OldLines == 0 {
+			h.OldStart--
+		}
+		if h.NewLines == 0 {
+			h.NewStart--
+		}
+
+		hunks = append(hunks, h)
+	}
+
+	return hunks
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.TrimSuffix(s, "\n")
+
+	return strings.Split(s, "\n")
+}
@@ -0,0 +1,270 @@
+// Package lockout protects logins against password guessing. It counts
+// consecutive failed attempts per key, such as an account or a client IP,
+// makes each further attempt wait exponentially longer, and locks the key
+// for a while once it has failed too often.
+package lockout
+
+import (
+	"sync"
+	"time"
+)
+
+// Record is what is stored about a key's recent failures.
+type Record struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// Store keeps Records. Get returns a zero Record for unknown keys.
+//
+// Add changes a key's failure count by n atomically, so that parallel
+// attempts can't overwrite each other's counts. It calls fn with the record
+// as it then is, keeping other attempts on the key waiting until fn returns.
+// fn may change the record further and returns whether to store it; if it
+// returns false, the count is left as it was. A record stored with no
+// failures and no lock is removed.
+//
+// Stores may keep times to the second only.
+type Store interface {
+	Get(key string) (Record, error)
+	Add(key string, n int, fn func(rec *Record) bool) error
+	Delete(key string) error
+}
+
+// Policy says how a Guard treats failures.
+type Policy struct {
+	// Free is the number of failures allowed before attempts are slowed
+	// down.
+	Free int
+	// BaseDelay is the wait after the first failure beyond Free. It doubles
+	// with each further failure, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockAfter is the number of failures after which the key is locked for
+	// LockFor. Failures are also forgotten once LockFor has passed since the
+	// last one.
+	LockAfter int
+	LockFor   time.Duration
+}
+
+// Status is whether a key may make an attempt now.
+type Status struct {
+	// Locked is set if the key has been locked, rather than only having to
+	// wait out a delay.
+	Locked bool
+	// Wait is how long until the next attempt is allowed, or 0 if one is
+	// allowed now.
+	Wait time.Duration
+}
+
+func (s Status) Allowed() bool {
+	return s.Wait <= 0
+}
+
+type Guard struct {
+	store  Store
+	policy Policy
+	now    func() time.Time
+}
+
+func New(store Store, policy Policy) *Guard {
+	return &Guard{store: store, policy: policy, now: time.Now}
+}
+
+// current returns rec with failures that are old enough to be forgotten
+// at now dropped.
+func (g *Guard) current(rec Record, now time.Time) Record {
+	if now.Before(rec.LockedUntil) {
+		return rec
+	}
+	if now.Sub(rec.LastFailure) >= g.policy.LockFor {
+		return Record{}
+	}
+
+	return rec
+}
+
+// delay returns how long to wait after the given number of failures.
+func (g *Guard) delay(failures int) time.Duration {
+	extra := failures - g.policy.Free
+	if extra <= 0 {
+		return 0
+	}
+
+	d := g.policy.BaseDelay
+	for i := 1; i < extra && d < g.policy.MaxDelay; i++ {
+		d *= 2
+	}
+
+	return min(d, g.policy.MaxDelay)
+}
+
+// status returns whether an attempt may be made at now, given the record
+// of earlier failures.
+func (g *Guard) status(rec Record, now time.Time) Status {
+	rec = g.current(rec, now)
+
+	if now.Before(rec.LockedUntil) {
+		return Status{Locked: true, Wait: rec.LockedUntil.Sub(now)}
+	}
+
+	next := rec.LastFailure.Add(g.delay(rec.Failures))
+	if now.Before(next) {
+		return Status{Wait: next.Sub(now)}
+	}
+
+	return Status{}
+}
+
+// Check reports whether key may make an attempt now.
+func (g *Guard) Check(key string) (Status, error) {
+	rec, err := g.store.Get(key)
+	if err != nil {
+		return Status{}, err
+	}
+
+	return g.status(rec, g.now()), nil
+}
+
+// Reservation is an attempt counted by Reserve.
+type Reservation struct {
+	// Status is the status of the key before the attempt. If it doesn't
+	// allow the attempt, nothing was counted.
+	Status
+	// Locked is set if the attempt locked the key, so that the caller can
+	// act on a new lockout once if the attempt does fail.
+	Locked bool
+
+	// at is when the attempt was counted, and previous the key's last
+	// failure before it.
+	at       time.Time
+	previous time.Time
+}
+
+// Reserve counts an attempt for key as failed before it is made, so that
+// parallel attempts can't all get past the check before any of them has
+// failed. If the returned reservation's status doesn't allow the attempt,
+// nothing is counted. An attempt that succeeds must be taken back with
+// Release or Reset.
+func (g *Guard) Reserve(key string) (Reservation, error) {
+	var res Reservation
+
+	err := g.store.Add(key, 1, func(rec *Record) bool {
+		now := g.now()
+
+		before := *rec
+		before.Failures--
+		before = g.current(before, now)
+
+		res.Status = g.status(before, now)
+		if !res.Allowed() {
+			return false
+		}
+
+		*rec = before
+		rec.Failures++
+		rec.LastFailure = now
+		res.at = now
+		res.previous = before.LastFailure
+
+		if rec.Failures >= g.policy.LockAfter {
+			rec.LockedUntil = now.Add(g.policy.LockFor)
+			res.Locked = true
+		}
+
+		return true
+	})
+	if err != nil {
+		return Reservation{}, err
+	}
+
+	return res, nil
+}
+
+// Release takes back an attempt reserved for key that succeeded, lifting
+// the lock if the attempt was what locked the key. Unless another attempt
+// has been counted since, the wait goes back to running from the failure
+// before the attempt. Unlike Reset, it leaves the key's other failures
+// counted.
+func (g *Guard) Release(key string, res Reservation) error {
+	return g.store.Add(key, -1, func(rec *Record) bool {
+		if rec.Failures < 0 {
+			return false
+		}
+		if rec.Failures < g.policy.LockAfter {
+			rec.LockedUntil = time.Time{}
+		}
+		// A store that keeps whole seconds may have rounded the time
+		// down.
+		if !rec.LastFailure.After(res.at) {
+			rec.LastFailure = res.previous
+		}
+		return true
+	})
+}
+
+// Reset forgets all failures for key, e.g. after a successful attempt, and
+// lifts any lock.
+func (g *Guard) Reset(key string) error {
+	return g.store.Delete(key)
+}
+
+// Memory is a Store that keeps records in memory. It is used by tests and
+// is safe for concurrent use. The zero value is ready to use.
+type Memory struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+func (m *Memory) Get(key string) (Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.records[key], nil
+}
+
+// Put stores the record for key, e.g. for tests to start from.
+func (m *Memory) Put(key string, rec Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.records == nil {
+		m.records = make(map[string]Record)
+	}
+	m.records[key] = rec
+
+	return nil
+}
+
+func (m *Memory) Add(key string, n int, fn func(rec *Record) bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rec := m.records[key]
+	rec.Failures += n
+	if !fn(&rec) {
+		return nil
+	}
+
+	if rec.Failures == 0 && rec.LockedUntil.IsZero() {
+		delete(m.records, key)
+		return nil
+	}
+
+	if m.records == nil {
+		m.records = make(map[string]Record)
+	}
+	m.records[key] = rec
+
+	return nil
+}
+
+func (m *Memory) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.records, key)
+
+	return nil
+}
@@ -0,0 +1,233 @@
+package lockout
+
+import (
+	"sync"
+	"testing"
+	"thienel/lets-go/internal/assert"
+	"time"
+)
+
+var testPolicy = Policy{
+	Free:      2,
+	BaseDelay: time.Second,
+	MaxDelay:  4 * time.Second,
+	LockAfter: 6,
+	LockFor:   time.Minute,
+}
+
+func newTestGuard() (*Guard, *time.Time) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	g := New(&Memory{}, testPolicy)
+	g.now = func() time.Time { return now }
+
+	return g, &now
+}
+
+func TestDelay(t *testing.T) {
+	g, _ := newTestGuard()
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{5, 4 * time.Second},
+		{6, 4 * time.Second},
+		{100, 4 * time.Second},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, g.delay(tt.failures), tt.want)
+	}
+}
+
+func TestGuard(t *testing.T) {
+	g, now := newTestGuard()
+
+	check := func(t *testing.T, key string) Status {
+		s, err := g.Check(key)
+		assert.NilErr(t, err)
+		return s
+	}
+	reserve := func(t *testing.T, key string) (Status, bool) {
+		res, err := g.Reserve(key)
+		assert.NilErr(t, err)
+		return res.Status, res.Locked
+	}
+
+	// The free failures don't slow anything down.
+	for range 3 {
+		s, locked := reserve(t, "a")
+		assert.Equal(t, s.Allowed(), true)
+		assert.Equal(t, locked, false)
+	}
+
+	// After that, each failure doubles the wait.
+	assert.Equal(t, check(t, "a"), Status{Wait: time.Second})
+	assert.Equal(t, check(t, "b").Allowed(), true)
+
+	// Refused attempts aren't counted.
+	s, _ := reserve(t, "a")
+	assert.Equal(t, s, Status{Wait: time.Second})
+	assert.Equal(t, check(t, "a"), Status{Wait: time.Second})
+
+	*now = now.Add(time.Second)
+	s, _ = reserve(t, "a")
+	assert.Equal(t, s.Allowed(), true)
+	assert.Equal(t, check(t, "a"), Status{Wait: 2 * time.Second})
+
+	*now = now.Add(2 * time.Second)
+	reserve(t, "a")
+	*now = now.Add(4 * time.Second)
+
+	// The sixth failure locks the key, once.
+	s, locked := reserve(t, "a")
+	assert.Equal(t, s.Allowed(), true)
+	assert.Equal(t, locked, true)
+	assert.Equal(t, check(t, "a"), Status{Locked: true, Wait: time.Minute})
+
+	s, locked = reserve(t, "a")
+	assert.Equal(t, s, Status{Locked: true, Wait: time.Minute})
+	assert.Equal(t, locked, false)
+
+	*now = now.Add(59 * time.Second)
+	assert.Equal(t, check(t, "a").Locked, true)
+
+	// Once the lock ends, the failures are forgotten.
+	*now = now.Add(time.Second)
+	assert.Equal(t, check(t, "a"), Status{})
+	_, locked = reserve(t, "a")
+	assert.Equal(t, locked, false)
+	assert.Equal(t, check(t, "a").Allowed(), true)
+
+	assert.NilErr(t, g.Reset("a"))
+	rec, err := g.store.Get("a")
+	assert.NilErr(t, err)
+	assert.Equal(t, rec, Record{})
+}
+
+func TestGuardRelease(t *testing.T) {
+	g, now := newTestGuard()
+
+	for range testPolicy.LockAfter - 1 {
+		_, err := g.Reserve("a")
+		assert.NilErr(t, err)
+		*now = now.Add(testPolicy.MaxDelay)
+	}
+	lastFailure := now.Add(-testPolicy.MaxDelay)
+
+	// An attempt that would have locked the key but succeeded takes its
+	// lock back with it, and the wait runs from the failure before it.
+	res, err := g.Reserve("a")
+	assert.NilErr(t, err)
+	assert.Equal(t, res.Locked, true)
+
+	assert.NilErr(t, g.Release("a", res))
+
+	rec, err := g.store.Get("a")
+	assert.NilErr(t, err)
+	assert.Equal(t, rec.Failures, testPolicy.LockAfter-1)
+	assert.Equal(t, rec.LastFailure, lastFailure)
+	assert.Equal(t, rec.LockedUntil, time.Time{})
+
+	// Releasing a key with nothing reserved does nothing.
+	assert.NilErr(t, g.Release("b", Reservation{}))
+	rec, err = g.store.Get("b")
+	assert.NilErr(t, err)
+	assert.Equal(t, rec, Record{})
+}
+
+func TestGuardConcurrent(t *testing.T) {
+	// Parallel attempts must not all get in before any has failed, and only
+	// one of them may lock the key.
+	policy := Policy{
+		Free:      2,
+		BaseDelay: time.Second,
+		MaxDelay:  time.Minute,
+		LockAfter: 3,
+		LockFor:   time.Minute,
+	}
+	g := New(&Memory{}, policy)
+
+	var mu sync.Mutex
+	var allowed, locks int
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			res, err := g.Reserve("a")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if res.Allowed() {
+				allowed++
+			}
+			if res.Locked {
+				locks++
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, allowed, policy.LockAfter)
+	assert.Equal(t, locks, 1)
+
+	rec, err := g.store.Get("a")
+	assert.NilErr(t, err)
+	assert.Equal(t, rec.Failures, policy.LockAfter)
+}
+
+func TestGuardReleaseLater(t *testing.T) {
+	g, now := newTestGuard()
+
+	first, err := g.Reserve("a")
+	assert.NilErr(t, err)
+	*now = now.Add(time.Second)
+	_, err = g.Reserve("a")
+	assert.NilErr(t, err)
+
+	// A failure counted after the released attempt keeps its time.
+	assert.NilErr(t, g.Release("a", first))
+	rec, err := g.store.Get("a")
+	assert.NilErr(t, err)
+	assert.Equal(t, rec, Record{Failures: 1, LastFailure: *now})
+
+	// A key with nothing left to count is forgotten.
+	g, _ = newTestGuard()
+	res, err := g.Reserve("a")
+	assert.NilErr(t, err)
+	assert.NilErr(t, g.Release("a", res))
+	rec, err = g.store.Get("a")
+	assert.NilErr(t, err)
+	assert.Equal(t, rec, Record{})
+}
+
+func TestGuardForgets(t *testing.T) {
+	g, now := newTestGuard()
+
+	for range 5 {
+		*now = now.Add(testPolicy.MaxDelay)
+		g.Reserve("a")
+	}
+
+	s, err := g.Check("a")
+	assert.NilErr(t, err)
+	assert.Equal(t, s.Allowed(), false)
+
+	*now = now.Add(time.Minute)
+
+	s, err = g.Check("a")
+	assert.NilErr(t, err)
+	assert.Equal(t, s, Status{})
+}
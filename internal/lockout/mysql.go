@@ -0,0 +1,115 @@
+package lockout
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// staleAfter is how long records are kept after their last failure, once
+// any lock has ended. It only needs to be longer than any Policy's LockFor.
+const staleAfter = 24 * time.Hour
+
+// MySQL is a Store in the login_attempts table, so that failures are
+// counted across restarts and between servers sharing the database.
+type MySQL struct {
+	DB *sql.DB
+}
+
+func (m *MySQL) Get(key string) (Record, error) {
+	var rec Record
+	var lockedUntil sql.NullTime
+
+	stmt := `SELECT failures, last_failure, locked_until FROM login_attempts
+	WHERE attempt_key = ?`
+
+	err := m.DB.QueryRow(stmt, key).Scan(&rec.Failures, &rec.LastFailure,
+		&lockedUntil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Record{}, nil
+		}
+		return Record{}, err
+	}
+
+	if lockedUntil.Valid {
+		rec.LockedUntil = lockedUntil.Time
+	}
+
+	return rec, nil
+}
+
+// Add changes the count in SQL, within a transaction that keeps the row
+// locked until fn has returned and any changes are stored. Stale records of
+// other keys are cleared out on the way.
+func (m *MySQL) Add(key string, n int, fn func(rec *Record) bool) error {
+	cutoff := time.Now().Add(-staleAfter).UTC()
+
+	_, err := m.DB.Exec(`DELETE FROM login_attempts WHERE last_failure < ?
+	AND (locked_until IS NULL OR locked_until < UTC_TIMESTAMP())`, cutoff)
+	if err != nil {
+		return err
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The insert or update locks the row for the rest of the transaction.
+	_, err = tx.Exec(`INSERT INTO login_attempts (attempt_key, failures,
+	last_failure) VALUES(?, ?, UTC_TIMESTAMP())
+	ON DUPLICATE KEY UPDATE failures = failures + VALUES(failures)`, key, n)
+	if err != nil {
+		return err
+	}
+
+	var rec Record
+	var lockedUntil sql.NullTime
+
+	err = tx.QueryRow(`SELECT failures, last_failure, locked_until
+	FROM login_attempts WHERE attempt_key = ?`, key).Scan(&rec.Failures,
+		&rec.LastFailure, &lockedUntil)
+	if err != nil {
+		return err
+	}
+
+	if lockedUntil.Valid {
+		rec.LockedUntil = lockedUntil.Time
+	}
+
+	if !fn(&rec) {
+		return nil
+	}
+
+	if rec.Failures == 0 && rec.LockedUntil.IsZero() {
+		_, err = tx.Exec(`DELETE FROM login_attempts WHERE attempt_key = ?`, key)
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	lockedUntil = sql.NullTime{}
+	if !rec.LockedUntil.IsZero() {
+		lockedUntil = sql.NullTime{Time: rec.LockedUntil.UTC(), Valid: true}
+	}
+
+	// The last failure is cut to the second that the DATETIME column keeps,
+	// rather than rounded by MySQL, so that it is never stored later than
+	// it was, which Guard.Release relies on.
+	_, err = tx.Exec(`UPDATE login_attempts SET failures = ?, last_failure = ?,
+	locked_until = ? WHERE attempt_key = ?`, rec.Failures,
+		rec.LastFailure.UTC().Truncate(time.Second), lockedUntil, key)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m *MySQL) Delete(key string) error {
+	_, err := m.DB.Exec(`DELETE FROM login_attempts WHERE attempt_key = ?`, key)
+	return err
+}
@@ -0,0 +1,145 @@
+package lockout
+
+import (
+	"database/sql"
+	"os"
+	"sync"
+	"testing"
+	"thienel/lets-go/internal/assert"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// newTestDB sets up the test database with the same scripts as the models
+// tests.
+func newTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("mysql", "test_web:pass@/test_snippetbox?parseTime=true"+
+		"&multiStatements=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	script, err := os.ReadFile("../models/testdata/setup.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.Exec(string(script))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		script, err := os.ReadFile("../models/testdata/teardown.sql")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = db.Exec(string(script))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		db.Close()
+	})
+
+	return db
+}
+
+func TestMySQL(t *testing.T) {
+	if testing.Short() {
+		t.Skip("lockout: skipping intergration test")
+	}
+
+	m := &MySQL{DB: newTestDB(t)}
+
+	rec, err := m.Get("account:alice@example.com")
+	assert.NilErr(t, err)
+	assert.Equal(t, rec, Record{})
+
+	now := time.Now().UTC().Truncate(time.Second)
+	want := Record{Failures: 3, LastFailure: now}
+
+	// A record is only stored if fn says so.
+	err = m.Add("account:alice@example.com", 1, func(rec *Record) bool {
+		assert.Equal(t, rec.Failures, 1)
+		return false
+	})
+	assert.NilErr(t, err)
+	rec, err = m.Get("account:alice@example.com")
+	assert.NilErr(t, err)
+	assert.Equal(t, rec.Failures, 0)
+
+	err = m.Add("account:alice@example.com", 1, func(rec *Record) bool {
+		*rec = want
+		return true
+	})
+	assert.NilErr(t, err)
+	rec, err = m.Get("account:alice@example.com")
+	assert.NilErr(t, err)
+	assert.Equal(t, rec, want)
+
+	err = m.Add("account:alice@example.com", 1, func(rec *Record) bool {
+		assert.Equal(t, rec.Failures, 4)
+		rec.LockedUntil = now.Add(time.Minute)
+		return true
+	})
+	assert.NilErr(t, err)
+	want.Failures = 4
+	want.LockedUntil = now.Add(time.Minute)
+	rec, err = m.Get("account:alice@example.com")
+	assert.NilErr(t, err)
+	assert.Equal(t, rec, want)
+
+	// Times are stored to the second, never later than they were.
+	err = m.Add("account:alice@example.com", 0, func(rec *Record) bool {
+		rec.LastFailure = now.Add(1999 * time.Millisecond)
+		return true
+	})
+	assert.NilErr(t, err)
+	rec, err = m.Get("account:alice@example.com")
+	assert.NilErr(t, err)
+	assert.Equal(t, rec.LastFailure, now.Add(time.Second))
+
+	// A record left with no failures and no lock is removed.
+	err = m.Add("ip:192.0.2.1", 1, func(rec *Record) bool {
+		rec.Failures = 0
+		return true
+	})
+	assert.NilErr(t, err)
+	var n int
+	err = m.DB.QueryRow(`SELECT COUNT(*) FROM login_attempts
+	WHERE attempt_key = ?`, "ip:192.0.2.1").Scan(&n)
+	assert.NilErr(t, err)
+	assert.Equal(t, n, 0)
+
+	assert.NilErr(t, m.Delete("account:alice@example.com"))
+	rec, err = m.Get("account:alice@example.com")
+	assert.NilErr(t, err)
+	assert.Equal(t, rec, Record{})
+}
+
+func TestMySQLConcurrent(t *testing.T) {
+	if testing.Short() {
+		t.Skip("lockout: skipping intergration test")
+	}
+
+	g := New(&MySQL{DB: newTestDB(t)}, testPolicy)
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := g.Reserve("ip:192.0.2.1")
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	rec, err := g.store.Get("ip:192.0.2.1")
+	assert.NilErr(t, err)
+	assert.Equal(t, rec.Failures, testPolicy.Free+1)
+}
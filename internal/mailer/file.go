@@ -0,0 +1,34 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// File writes each message to its own .eml file in Dir instead of sending
+// it. It is meant for development, where there is no SMTP server.
+type File struct {
+	Dir    string
+	Sender string
+}
+
+func (m *File) Send(to, templateFile string, data any) error {
+	msg, err := render(to, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(m.Dir, 0o700)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405.000000000"),
+		strings.TrimSuffix(templateFile, filepath.Ext(templateFile)))
+
+	return os.WriteFile(filepath.Join(m.Dir, name), msg.format(m.Sender, now), 0o600)
+}
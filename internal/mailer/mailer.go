@@ -0,0 +1,91 @@
+// Package mailer sends the application's emails. Messages are rendered from
+// the templates in templates/, each of which defines a "subject" and a
+// "plainBody" template.
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"mime"
+	"net/mail"
+	"strings"
+	"text/template"
+	"time"
+)
+
+//go:embed "templates"
+var templateFS embed.FS
+
+// Mailer sends the message rendered from templateFile with data to the
+// given address.
+type Mailer interface {
+	Send(to, templateFile string, data any) error
+}
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+var errHeaderInjection = errors.New("mailer: line break in header")
+
+func render(to, templateFile string, data any) (*Message, error) {
+	if strings.ContainsAny(to, "\r\n") {
+		return nil, errHeaderInjection
+	}
+
+	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(subject, "subject", data)
+	if err != nil {
+		return nil, err
+	}
+	if strings.ContainsAny(subject.String(), "\r\n") {
+		return nil, errHeaderInjection
+	}
+
+	body := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(body, "plainBody", data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		To:      to,
+		Subject: subject.String(),
+		Body:    strings.TrimSpace(body.String()) + "\n",
+	}, nil
+}
+
+// format returns the message in RFC 5322 form, ready to hand to an SMTP
+// server.
+func (msg *Message) format(from string, date time.Time) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return b.Bytes()
+}
+
+// senderAddress returns the bare address of a sender such as
+// "Snippetbox <no-reply@example.com>".
+func senderAddress(sender string) (string, error) {
+	addr, err := mail.ParseAddress(sender)
+	if err != nil {
+		return "", fmt.Errorf("mailer: invalid sender %q: %w", sender, err)
+	}
+	return addr.Address, nil
+}
@@ -0,0 +1,95 @@
+package mailer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"thienel/lets-go/internal/assert"
+	"time"
+)
+
+var resetData = map[string]any{
+	"Name": "Alice",
+	"URL":  "https://snippets.example.com/user/password/reset?token=abc",
+	"TTL":  "an hour",
+}
+
+func TestRender(t *testing.T) {
+	msg, err := render("alice@example.com", "password_reset.tmpl", resetData)
+	assert.NilErr(t, err)
+
+	assert.Equal(t, msg.To, "alice@example.com")
+	assert.Equal(t, msg.Subject, "Reset your Snippetbox password")
+	assert.StringContains(t, msg.Body, "Hi Alice,")
+	assert.StringContains(t, msg.Body, "within an hour:\n\n"+resetData["URL"].(string))
+
+	_, err = render("alice@example.com\r\nBcc: eve@example.com",
+		"password_reset.tmpl", resetData)
+	assert.Equal(t, err, errHeaderInjection)
+}
+
+func TestRenderEmailVerification(t *testing.T) {
+	msg, err := render("carol@example.com", "email_verification.tmpl", map[string]any{
+		"Name": "Carol",
+		"URL":  "https://snippets.example.com/user/verify?token=abc",
+		"TTL":  "a day",
+	})
+	assert.NilErr(t, err)
+
+	assert.Equal(t, msg.Subject, "Verify your Snippetbox email address")
+	assert.StringContains(t, msg.Body,
+		"within a day:\n\nhttps://snippets.example.com/user/verify?token=abc")
+}
+
+func TestFormat(t *testing.T) {
+	msg := &Message{To: "alice@example.com", Subject: "Héllo", Body: "one\ntwo\n"}
+	date := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	got := string(msg.format("Snippetbox <no-reply@example.com>", date))
+
+	assert.StringContains(t, got, "From: Snippetbox <no-reply@example.com>\r\n")
+	assert.StringContains(t, got, "To: alice@example.com\r\n")
+	assert.StringContains(t, got, "Subject: =?utf-8?q?H=C3=A9llo?=\r\n")
+	assert.StringContains(t, got, "Date: Tue, 02 Jan 2024 03:04:05 +0000\r\n")
+	assert.StringContains(t, got, "\r\n\r\none\r\ntwo\r\n")
+}
+
+func TestMemory(t *testing.T) {
+	m := &Memory{}
+
+	err := m.Send("alice@example.com", "password_reset.tmpl", resetData)
+	assert.NilErr(t, err)
+
+	msgs := m.Messages()
+	assert.Equal(t, len(msgs), 1)
+	assert.Equal(t, msgs[0].To, "alice@example.com")
+}
+
+func TestFile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	m := &File{Dir: dir, Sender: "Snippetbox <no-reply@example.com>"}
+
+	err := m.Send("alice@example.com", "password_reset.tmpl", resetData)
+	assert.NilErr(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*-password_reset.eml"))
+	assert.NilErr(t, err)
+	assert.Equal(t, len(files), 1)
+
+	b, err := os.ReadFile(files[0])
+	assert.NilErr(t, err)
+	assert.Equal(t, strings.HasPrefix(string(b), "From: Snippetbox"), true)
+	assert.StringContains(t, string(b), "Subject: Reset your Snippetbox password")
+}
+
+func TestNewSMTP(t *testing.T) {
+	m, err := NewSMTP("smtp.example.com", 587, "user", "pass",
+		"Snippetbox <no-reply@example.com>")
+	assert.NilErr(t, err)
+	assert.Equal(t, m.addr, "smtp.example.com:587")
+	assert.Equal(t, m.from, "no-reply@example.com")
+
+	_, err = NewSMTP("smtp.example.com", 587, "", "", "not an address")
+	assert.Equal(t, err != nil, true)
+}
@@ -0,0 +1,45 @@
+package mailer
+
+import (
+	"fmt"
+	"net/smtp"
+	"time"
+)
+
+// SMTP sends mail through an SMTP server.
+type SMTP struct {
+	addr   string
+	auth   smtp.Auth
+	sender string
+	from   string
+}
+
+// NewSMTP returns a mailer that sends through the server at host:port,
+// authenticating with username and password unless username is empty.
+func NewSMTP(host string, port int, username, password, sender string) (*SMTP, error) {
+	from, err := senderAddress(sender)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &SMTP{
+		addr:   fmt.Sprintf("%s:%d", host, port),
+		sender: sender,
+		from:   from,
+	}
+	if username != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return m, nil
+}
+
+func (m *SMTP) Send(to, templateFile string, data any) error {
+	msg, err := render(to, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{to},
+		msg.format(m.sender, time.Now()))
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+type AccountUnlockModelInterface interface {
+	Insert(userId int, ttl time.Duration) (string, error)
+	Consume(plaintext string) (int, error)
+}
+
+// AccountUnlockModel manages the one-time tokens in the links emailed to
+// users whose account has been locked after too many failed logins.
+type AccountUnlockModel struct {
+	DB *sql.DB
+}
+
+func (m *AccountUnlockModel) tokens() oneTimeTokens {
+	return oneTimeTokens{db: m.DB, table: "account_unlocks"}
+}
+
+// Insert creates an unlock token for the user that is valid for ttl and
+// returns its plaintext.
+func (m *AccountUnlockModel) Insert(userId int, ttl time.Duration) (string, error) {
+	return m.tokens().insert(userId, ttl)
+}
+
+// Consume uses up an unlock token and returns the id of the user it was
+// issued to. It returns ErrInvalidCredentials if the token is unknown or
+// expired.
+func (m *AccountUnlockModel) Consume(plaintext string) (int, error) {
+	return m.tokens().consume(plaintext, nil)
+}
+
+// DeleteExpired removes up to limit tokens that expired before the given
+// time, for the reaper.
+func (m *AccountUnlockModel) DeleteExpired(before time.Time, limit int) (int, error) {
+	return m.tokens().deleteExpired(before, limit)
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"testing"
+	"thienel/lets-go/internal/assert"
+	"time"
+)
+
+func TestAccountUnlockModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping intergration test")
+	}
+
+	db := newTestDB(t)
+	m := AccountUnlockModel{db}
+
+	first, err := m.Insert(1, time.Hour)
+	assert.NilErr(t, err)
+
+	second, err := m.Insert(1, time.Hour)
+	assert.NilErr(t, err)
+
+	_, err = m.Consume(first)
+	assert.Equal(t, err, ErrInvalidCredentials)
+
+	userId, err := m.Consume(second)
+	assert.NilErr(t, err)
+	assert.Equal(t, userId, 1)
+
+	_, err = m.Consume(second)
+	assert.Equal(t, err, ErrInvalidCredentials)
+
+	expired, err := m.Insert(1, -time.Minute)
+	assert.NilErr(t, err)
+
+	_, err = m.Consume(expired)
+	assert.Equal(t, err, ErrInvalidCredentials)
+}
+
+func TestAuditModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping intergration test")
+	}
+
+	db := newTestDB(t)
+	m := AuditModel{db}
+
+	err := m.Insert(&AuditEntry{UserId: 1, Event: AuditAccountLocked,
+		IP: "192.0.2.1", Detail: "alice@example.com"})
+	assert.NilErr(t, err)
+
+	err = m.Insert(&AuditEntry{Event: AuditIPLocked, IP: "192.0.2.1"})
+	assert.NilErr(t, err)
+
+	var withUser, withoutUser int
+	err = db.QueryRow(`SELECT COUNT(user_id), COUNT(*) - COUNT(user_id)
+	FROM audit_log`).Scan(&withUser, &withoutUser)
+	assert.NilErr(t, err)
+	assert.Equal(t, withUser, 1)
+	assert.Equal(t, withoutUser, 1)
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Audit events.
+const (
+	AuditAccountLocked   = "account_locked"
+	AuditIPLocked        = "ip_locked"
+	AuditAccountUnlocked = "account_unlocked"
+)
+
+type AuditModelInterface interface {
+	Insert(entry *AuditEntry) error
+}
+
+// AuditEntry records a security-relevant event in the audit_log table. UserId is 0 for events that
+// aren't about a known user, such as an IP address being locked out.
+type AuditEntry struct {
+	Id      int
+	UserId  int
+	Event   string
+	IP      string
+	Detail  string
+	Created time.Time
+}
+
+type AuditModel struct {
+	DB *sql.DB
+}
+
+func (m *AuditModel) Insert(entry *AuditEntry) error {
+	var userId sql.NullInt64
+	if entry.UserId != 0 {
+		userId = sql.NullInt64{Int64: int64(entry.UserId), Valid: true}
+	}
+
+	stmt := `INSERT INTO audit_log (user_id, event, ip, detail, created)
+	VALUES(?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	_, err := m.DB.Exec(stmt, userId, entry.Event, entry.IP, entry.Detail)
+	return err
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"encoding/base64"
+	"fmt"
+	"time"
+)
+
+// Cursor marks a position in a listing ordered by (created, id). It is
+// passed between requests as an opaque string.
+type Cursor struct {
+	Created time.Time
+	Id      int
+}
+
+func NewCursor(s *Snippet) *Cursor {
+	return &Cursor{Created: s.Created, Id: s.Id}
+}
+
+func (c *Cursor) String() string {
+	raw := fmt.Sprintf("%d-%d", c.Created.Unix(), c.Id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func ParseCursor(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var created int64
+	var id int
+	n, err := fmt.Sscanf(string(raw), "%d-%d", &created, &id)
+	if err != nil || n != 2 || id < 1 {
+		return nil, ErrInvalidCursor
+	}
+
+	return &Cursor{Created: time.Unix(created, 0).UTC(), Id: id}, nil
+}
+
+type SnippetPage struct {
+	Snippets []*Snippet
+	// Next is the cursor for older snippets and Prev the cursor for newer
+	// ones. Either is nil when there is nothing further in that direction.
+	Next *Cursor
+	Prev *Cursor
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"testing"
+	"thienel/lets-go/internal/assert"
+	"time"
+)
+
+func TestParseCursor(t *testing.T) {
+	created := time.Date(2022, 3, 17, 10, 15, 0, 0, time.UTC)
+	valid := (&Cursor{Created: created, Id: 42}).String()
+
+	tests := []struct {
+		name    string
+		cursor  string
+		wantId  int
+		wantErr error
+	}{
+		{
+			name:   "Round trip",
+			cursor: valid,
+			wantId: 42,
+		},
+		{
+			name:    "Not base64",
+			cursor:  "!!!",
+			wantErr: ErrInvalidCursor,
+		},
+		{
+			name:    "Garbage",
+			cursor:  "Zm9v",
+			wantErr: ErrInvalidCursor,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseCursor(tt.cursor)
+
+			assert.Equal(t, err, tt.wantErr)
+
+			if tt.wantErr == nil {
+				assert.Equal(t, c.Id, tt.wantId)
+				assert.Equal(t, c.Created.Equal(created), true)
+			}
+		})
+	}
+}
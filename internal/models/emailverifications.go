@@ -0,0 +1,43 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+type EmailVerificationModelInterface interface {
+	Insert(userId int, ttl time.Duration) (string, error)
+	Verify(plaintext string) (int, error)
+}
+
+// EmailVerificationModel manages the one-time tokens in the links emailed to
+// new users to confirm their address.
+type EmailVerificationModel struct {
+	DB *sql.DB
+}
+
+func (m *EmailVerificationModel) tokens() oneTimeTokens {
+	return oneTimeTokens{db: m.DB, table: "email_verifications"}
+}
+
+// Insert creates a verification token for the user that is valid for ttl
+// and returns its plaintext.
+func (m *EmailVerificationModel) Insert(userId int, ttl time.Duration) (string, error) {
+	return m.tokens().insert(userId, ttl)
+}
+
+// Verify marks the email address of the user the token was issued to as
+// verified, uses up the token and returns the user's id. It returns
+// ErrInvalidCredentials if the token is unknown or expired.
+func (m *EmailVerificationModel) Verify(plaintext string) (int, error) {
+	return m.tokens().consume(plaintext, func(tx *sql.Tx, userId int) error {
+		_, err := tx.Exec(`UPDATE users SET email_verified = TRUE WHERE id = ?`, userId)
+		return err
+	})
+}
+
+// DeleteExpired removes up to limit tokens that expired before the given
+// time, for the reaper.
+func (m *EmailVerificationModel) DeleteExpired(before time.Time, limit int) (int, error) {
+	return m.tokens().deleteExpired(before, limit)
+}
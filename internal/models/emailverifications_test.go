@@ -0,0 +1,44 @@
+package models
+
+import (
+	"testing"
+	"thienel/lets-go/internal/assert"
+	"time"
+)
+
+func TestEmailVerificationModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping intergration test")
+	}
+
+	db := newTestDB(t)
+	users := UserModel{db}
+	m := EmailVerificationModel{db}
+
+	id, err := users.Insert("Bob", "bob@example.com", "pa$$word")
+	assert.NilErr(t, err)
+
+	user, err := users.Get(id)
+	assert.NilErr(t, err)
+	assert.Equal(t, user.EmailVerified, false)
+
+	expired, err := m.Insert(id, -time.Minute)
+	assert.NilErr(t, err)
+
+	_, err = m.Verify(expired)
+	assert.Equal(t, err, ErrInvalidCredentials)
+
+	token, err := m.Insert(id, time.Hour)
+	assert.NilErr(t, err)
+
+	userId, err := m.Verify(token)
+	assert.NilErr(t, err)
+	assert.Equal(t, userId, id)
+
+	user, err = users.Get(id)
+	assert.NilErr(t, err)
+	assert.Equal(t, user.EmailVerified, true)
+
+	_, err = m.Verify(token)
+	assert.Equal(t, err, ErrInvalidCredentials)
+}
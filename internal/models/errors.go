@@ -6,4 +6,5 @@ var (
 	ErrNoRecord           = errors.New("models: no marching record found")
 	ErrInvalidCredentials = errors.New("models: invalid credentials")
 	ErrDuplicateEmail     = errors.New("models: duplicate email")
+	ErrInvalidCursor      = errors.New("models: invalid cursor")
 )
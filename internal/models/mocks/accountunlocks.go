@@ -0,0 +1,23 @@
+package mocks
+
+import (
+	"thienel/lets-go/internal/models"
+	"time"
+)
+
+// MockUnlockToken is a valid account unlock token for Alice.
+const MockUnlockToken = "dW5sb2NrLWFsaWNl"
+
+type AccountUnlockModel struct{}
+
+func (m *AccountUnlockModel) Insert(userId int, ttl time.Duration) (string, error) {
+	return MockUnlockToken, nil
+}
+
+func (m *AccountUnlockModel) Consume(plaintext string) (int, error) {
+	if plaintext == MockUnlockToken {
+		return 1, nil
+	}
+
+	return 0, models.ErrInvalidCredentials
+}
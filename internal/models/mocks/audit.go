@@ -0,0 +1,29 @@
+package mocks
+
+import (
+	"sync"
+	"thienel/lets-go/internal/models"
+)
+
+// AuditModel keeps entries in memory so that tests can check what was
+// recorded.
+type AuditModel struct {
+	mu      sync.Mutex
+	entries []models.AuditEntry
+}
+
+func (m *AuditModel) Insert(entry *models.AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.entries = append(m.entries, *entry)
+	return nil
+}
+
+// Entries returns a copy of the entries recorded so far.
+func (m *AuditModel) Entries() []models.AuditEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]models.AuditEntry(nil), m.entries...)
+}
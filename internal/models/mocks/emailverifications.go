@@ -0,0 +1,23 @@
+package mocks
+
+import (
+	"thienel/lets-go/internal/models"
+	"time"
+)
+
+// MockVerificationToken is a valid email verification token for Carol.
+const MockVerificationToken = "dmVyaWZ5LWNhcm9s"
+
+type EmailVerificationModel struct{}
+
+func (m *EmailVerificationModel) Insert(userId int, ttl time.Duration) (string, error) {
+	return MockVerificationToken, nil
+}
+
+func (m *EmailVerificationModel) Verify(plaintext string) (int, error) {
+	if plaintext == MockVerificationToken {
+		return 3, nil
+	}
+
+	return 0, models.ErrInvalidCredentials
+}
@@ -0,0 +1,27 @@
+package mocks
+
+import (
+	"thienel/lets-go/internal/models"
+	"time"
+)
+
+// MockResetToken is a valid password reset token for Alice.
+const MockResetToken = "cmVzZXQtdG9rZW4tZm9yLWFsaWNl"
+
+type PasswordResetModel struct{}
+
+func (m *PasswordResetModel) Insert(userId int, ttl time.Duration) (string, error) {
+	return MockResetToken, nil
+}
+
+func (m *PasswordResetModel) Get(plaintext string) (int, error) {
+	if plaintext == MockResetToken {
+		return 1, nil
+	}
+
+	return 0, models.ErrInvalidCredentials
+}
+
+func (m *PasswordResetModel) ResetPassword(plaintext, password string) (int, error) {
+	return m.Get(plaintext)
+}
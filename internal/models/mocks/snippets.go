@@ -1,33 +1,302 @@
 package mocks
 
 import (
+	"slices"
+	"strings"
 	"thienel/lets-go/internal/models"
 	"time"
 )
 
 var mockSnippet = &models.Snippet{
-	Id:      1,
-	Title:   "An old silent pond",
-	Content: "An old silent pond...",
-	Created: time.Now(),
-	Expires: time.Now(),
+	Id:         1,
+	Slug:       "b2xkLXBvbmQx",
+	UserId:     1,
+	UserName:   "Alice",
+	Title:      "An old silent pond",
+	Content:    "An old silent pond...",
+	Language:   "plaintext",
+	Visibility: models.VisibilityPublic,
+	Created:    time.Now(),
+	Expires:    time.Now(),
+	Tags:       []string{"poetry"},
+}
+
+var mockPrivateSnippet = &models.Snippet{
+	Id:         5,
+	Slug:       "cHJpdmF0ZS01",
+	UserId:     1,
+	UserName:   "Alice",
+	Title:      "A private note",
+	Content:    "Only Alice can read this",
+	Visibility: models.VisibilityPrivate,
+	Created:    time.Now(),
+	Expires:    time.Now(),
+}
+
+var mockUnlistedSnippet = &models.Snippet{
+	Id:         6,
+	Slug:       "dW5saXN0ZWQ2",
+	UserId:     1,
+	UserName:   "Alice",
+	Title:      "An unlisted note",
+	Content:    "Anyone with the link can read this",
+	Visibility: models.VisibilityUnlisted,
+	Created:    time.Now(),
+	Expires:    time.Now(),
+}
+
+var mockBurnSnippet = &models.Snippet{
+	Id:               7,
+	Slug:             "YnVybi1hZnRl",
+	UserId:           1,
+	UserName:         "Alice",
+	Title:            "Database password",
+	Content:          "hunter2",
+	Visibility:       models.VisibilityUnlisted,
+	BurnAfterReading: true,
+	Created:          time.Now(),
+	Expires:          time.Now(),
+}
+
+var mockProtectedSnippet = &models.Snippet{
+	Id:         8,
+	Slug:       "cHJvdGVjdGVk",
+	UserId:     1,
+	UserName:   "Alice",
+	Title:      "A protected note",
+	Content:    "Only people with the password can read this",
+	Visibility: models.VisibilityPublic,
+	Protected:  true,
+	Created:    time.Now(),
+	Expires:    time.Now(),
+}
+
+// mockNewSnippet is what Insert pretends to have created.
+var mockNewSnippet = &models.Snippet{
+	Id:         9,
+	Slug:       "bmV3LXNuaXBw",
+	UserId:     1,
+	UserName:   "Alice",
+	Title:      "O snail",
+	Content:    "O snail\nClimb Mount Fuji,\nBut slowly, slowly!",
+	Visibility: models.VisibilityPublic,
+	Created:    time.Now(),
+	Expires:    time.Now(),
+}
+
+var mockOtherSnippet = &models.Snippet{
+	Id:         3,
+	Slug:       "d2ludHJ5LWZv",
+	UserId:     2,
+	UserName:   "Bob",
+	Title:      "Over the wintry forest",
+	Content:    "Over the wintry forest, winds howl in rage...",
+	Visibility: models.VisibilityPublic,
+	Created:    time.Now(),
+	Expires:    time.Now(),
+}
+
+var mockDeletedSnippet = &models.Snippet{
+	Id:         4,
+	Slug:       "YXV0dW1uLW1v",
+	UserId:     1,
+	UserName:   "Alice",
+	Title:      "First autumn morning",
+	Content:    "First autumn morning, the mirror I stare into...",
+	Visibility: models.VisibilityPublic,
+	Created:    time.Now(),
+	Expires:    time.Now(),
+	Deleted:    time.Now(),
+}
+
+var mockRevisions = []*models.Revision{
+	{
+		Id:        2,
+		SnippetId: 1,
+		UserId:    1,
+		UserName:  "Alice",
+		Title:     "An old silent pond",
+		Content:   "An old silent pond...\nA frog jumps into the pond,",
+		Created:   time.Now(),
+	},
+	{
+		Id:        1,
+		SnippetId: 1,
+		UserId:    1,
+		UserName:  "Alice",
+		Title:     "An old silent pond",
+		Content:   "An old silent pond...",
+		Created:   time.Now().Add(-time.Hour),
+	},
 }
 
 type SnippetModel struct{}
 
-func (m *SnippetModel) Insert(title string, content string, expires int) (int, error) {
-	return 2, nil
+func (m *SnippetModel) Insert(userId int, title string, content string,
+	language string, visibility string, expires time.Time,
+	burnAfterReading bool, password string, tags []string) (int, string, error) {
+	return mockNewSnippet.Id, mockNewSnippet.Slug, nil
 }
 
 func (m *SnippetModel) Get(id int) (*models.Snippet, error) {
 	switch id {
 	case 1:
 		return mockSnippet, nil
+	case 3:
+		return mockOtherSnippet, nil
+	case 5:
+		return mockPrivateSnippet, nil
+	case 6:
+		return mockUnlistedSnippet, nil
+	case 7:
+		return mockBurnSnippet, nil
+	case 8:
+		return mockProtectedSnippet, nil
+	case 9:
+		return mockNewSnippet, nil
 	default:
 		return nil, models.ErrNoRecord
 	}
 }
 
+func (m *SnippetModel) GetBySlug(slug string) (*models.Snippet, error) {
+	for _, s := range []*models.Snippet{mockSnippet, mockOtherSnippet,
+		mockPrivateSnippet, mockUnlistedSnippet, mockBurnSnippet, mockProtectedSnippet, mockNewSnippet} {
+		if s.Slug == slug {
+			return s, nil
+		}
+	}
+
+	return nil, models.ErrNoRecord
+}
+
+func (m *SnippetModel) Burn(slug string) (*models.Snippet, error) {
+	if slug == mockBurnSnippet.Slug {
+		return mockBurnSnippet, nil
+	}
+
+	return nil, models.ErrNoRecord
+}
+
+func (m *SnippetModel) Unlock(id int, password string) error {
+	if id != mockProtectedSnippet.Id {
+		return models.ErrNoRecord
+	}
+
+	if password != "open sesame" {
+		return models.ErrInvalidCredentials
+	}
+
+	return nil
+}
+
+func (m *SnippetModel) Update(id int, title string, content string,
+	language string, visibility string, expires time.Time, tags []string) error {
+	switch id {
+	case 1, 3, 5, 6, 7, 8:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+
 func (m *SnippetModel) Lastest() ([]*models.Snippet, error) {
 	return []*models.Snippet{mockSnippet}, nil
 }
+
+func (m *SnippetModel) Page(after *models.Cursor, before *models.Cursor,
+	limit int) (*models.SnippetPage, error) {
+	page := &models.SnippetPage{Snippets: []*models.Snippet{mockSnippet}}
+
+	if after == nil {
+		page.Next = models.NewCursor(mockSnippet)
+	}
+	if after != nil || before != nil {
+		page.Prev = models.NewCursor(mockSnippet)
+	}
+
+	return page, nil
+}
+
+func (m *SnippetModel) Search(query string, page int) ([]*models.Snippet, bool, error) {
+	if page == 1 && strings.Contains(strings.ToLower(mockSnippet.Content),
+		strings.ToLower(query)) {
+		return []*models.Snippet{mockSnippet}, false, nil
+	}
+
+	return []*models.Snippet{}, false, nil
+}
+
+func (m *SnippetModel) ByTag(name string) ([]*models.Snippet, error) {
+	if slices.Contains(mockSnippet.Tags, name) {
+		return []*models.Snippet{mockSnippet}, nil
+	}
+
+	return []*models.Snippet{}, nil
+}
+
+func (m *SnippetModel) TagCloud(limit int) ([]*models.Tag, error) {
+	return []*models.Tag{{Name: "poetry", Count: 1}}, nil
+}
+
+func (m *SnippetModel) GetByUser(userId int) ([]*models.Snippet, error) {
+	switch userId {
+	case 1:
+		return []*models.Snippet{mockSnippet, mockPrivateSnippet, mockUnlistedSnippet}, nil
+	default:
+		return []*models.Snippet{}, nil
+	}
+}
+
+func (m *SnippetModel) Delete(id int) error {
+	switch id {
+	case 1, 3, 5, 6, 7, 8:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+
+func (m *SnippetModel) Trash(userId int) ([]*models.Snippet, error) {
+	switch userId {
+	case 1:
+		return []*models.Snippet{mockDeletedSnippet}, nil
+	default:
+		return []*models.Snippet{}, nil
+	}
+}
+
+func (m *SnippetModel) Restore(id int, userId int) error {
+	if id == mockDeletedSnippet.Id && userId == mockDeletedSnippet.UserId {
+		return nil
+	}
+
+	return models.ErrNoRecord
+}
+
+func (m *SnippetModel) Purge(id int, userId int) error {
+	if id == mockDeletedSnippet.Id && userId == mockDeletedSnippet.UserId {
+		return nil
+	}
+
+	return models.ErrNoRecord
+}
+
+func (m *SnippetModel) Revisions(snippetId int) ([]*models.Revision, error) {
+	switch snippetId {
+	case 1:
+		return mockRevisions, nil
+	default:
+		return []*models.Revision{}, nil
+	}
+}
+
+func (m *SnippetModel) GetRevision(snippetId int, id int) (*models.Revision, error) {
+	for _, r := range mockRevisions {
+		if r.SnippetId == snippetId && r.Id == id {
+			return r, nil
+		}
+	}
+
+	return nil, models.ErrNoRecord
+}
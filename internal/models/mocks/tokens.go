@@ -0,0 +1,72 @@
+package mocks
+
+import (
+	"thienel/lets-go/internal/models"
+	"time"
+)
+
+// Plaintexts of the mock tokens, for use in Authorization headers.
+const (
+	MockReadToken      = "sb_cmVhZC10b2tlbg"
+	MockReadWriteToken = "sb_cmVhZC13cml0ZS10b2tlbg"
+	// MockUnverifiedToken belongs to Carol, whose email isn't verified.
+	MockUnverifiedToken = "sb_dW52ZXJpZmllZA"
+)
+
+var mockTokens = map[string]*models.Token{
+	MockReadToken: {
+		Id:      1,
+		UserId:  1,
+		Name:    "Read only",
+		Scopes:  []string{models.ScopeRead},
+		Created: time.Now(),
+	},
+	MockReadWriteToken: {
+		Id:      2,
+		UserId:  1,
+		Name:    "Deploy script",
+		Scopes:  []string{models.ScopeRead, models.ScopeWrite},
+		Created: time.Now(),
+	},
+	MockUnverifiedToken: {
+		Id:      3,
+		UserId:  3,
+		Name:    "Laptop",
+		Scopes:  []string{models.ScopeRead, models.ScopeWrite},
+		Created: time.Now(),
+	},
+}
+
+type TokenModel struct{}
+
+func (m *TokenModel) Insert(userId int, name string, scopes []string) (string, error) {
+	return "sb_bmV3LXRva2Vu", nil
+}
+
+func (m *TokenModel) GetByUser(userId int) ([]*models.Token, error) {
+	if userId == 1 {
+		return []*models.Token{mockTokens[MockReadWriteToken],
+			mockTokens[MockReadToken]}, nil
+	}
+
+	return []*models.Token{}, nil
+}
+
+func (m *TokenModel) Delete(id int, userId int) error {
+	for _, t := range mockTokens {
+		if t.Id == id && t.UserId == userId {
+			return nil
+		}
+	}
+
+	return models.ErrNoRecord
+}
+
+func (m *TokenModel) Authenticate(plaintext string) (*models.Token, error) {
+	t, ok := mockTokens[plaintext]
+	if !ok {
+		return nil, models.ErrInvalidCredentials
+	}
+
+	return t, nil
+}
@@ -0,0 +1,47 @@
+package mocks
+
+import "thienel/lets-go/internal/models"
+
+// Dave's TOTP secret and one of his recovery codes.
+const (
+	MockTOTPSecret   = "JBSWY3DPEHPK3PXP"
+	MockRecoveryCode = "7qhe2-xkm4d"
+)
+
+type TwoFactorModel struct{}
+
+func (m *TwoFactorModel) Enable(userId int, secret string, step int64) ([]string, error) {
+	return []string{MockRecoveryCode, "m2v5a-p3ouw"}, nil
+}
+
+func (m *TwoFactorModel) Disable(userId int) error {
+	return nil
+}
+
+func (m *TwoFactorModel) Secret(userId int) (string, error) {
+	if userId == 5 {
+		return MockTOTPSecret, nil
+	}
+
+	return "", models.ErrNoRecord
+}
+
+func (m *TwoFactorModel) UseStep(userId int, step int64) error {
+	return nil
+}
+
+func (m *TwoFactorModel) UseRecoveryCode(userId int, code string) error {
+	if userId == 5 && code == MockRecoveryCode {
+		return nil
+	}
+
+	return models.ErrInvalidCredentials
+}
+
+func (m *TwoFactorModel) RecoveryCodesLeft(userId int) (int, error) {
+	if userId == 5 {
+		return 9, nil
+	}
+
+	return 0, nil
+}
@@ -7,12 +7,12 @@ import (
 
 type UserModel struct{}
 
-func (m *UserModel) Insert(name, email, password string) error {
+func (m *UserModel) Insert(name, email, password string) (int, error) {
 	switch email {
 	case "dupe@example.com":
-		return models.ErrDuplicateEmail
+		return 0, models.ErrDuplicateEmail
 	default:
-		return nil
+		return 4, nil
 	}
 }
 
@@ -20,13 +20,22 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 	if email == "alice@example.com" && password == "pa$$word" {
 		return 1, nil
 	}
+	if email == "bob@example.com" && password == "pa$$word" {
+		return 2, nil
+	}
+	if email == "carol@example.com" && password == "pa$$word" {
+		return 3, nil
+	}
+	if email == "dave@example.com" && password == "pa$$word" {
+		return 5, nil
+	}
 
 	return 0, models.ErrInvalidCredentials
 }
 
 func (m *UserModel) Exists(id int) (bool, error) {
 	switch id {
-	case 1:
+	case 1, 2, 3, 5:
 		return true, nil
 	default:
 		return false, nil
@@ -36,16 +45,61 @@ func (m *UserModel) Exists(id int) (bool, error) {
 func (m *UserModel) Get(id int) (*models.User, error) {
 	if id == 1 {
 		return &models.User{
-			Id:      1,
-			Name:    "Alice",
-			Email:   "alice@email.com",
+			Id:            1,
+			Name:          "Alice",
+			Email:         "alice@example.com",
+			EmailVerified: true,
+			Created:       time.Now(),
+		}, nil
+	}
+	if id == 2 {
+		return &models.User{
+			Id:            2,
+			Name:          "Bob",
+			Email:         "bob@example.com",
+			EmailVerified: true,
+			Created:       time.Now(),
+		}, nil
+	}
+	// Carol's email address hasn't been verified yet.
+	if id == 3 {
+		return &models.User{
+			Id:      3,
+			Name:    "Carol",
+			Email:   "carol@example.com",
 			Created: time.Now(),
 		}, nil
 	}
+	// Dave has turned on two-factor authentication.
+	if id == 5 {
+		return &models.User{
+			Id:               5,
+			Name:             "Dave",
+			Email:            "dave@example.com",
+			EmailVerified:    true,
+			TwoFactorEnabled: true,
+			Created:          time.Now(),
+		}, nil
+	}
 
 	return nil, models.ErrNoRecord
 }
 
+func (m *UserModel) GetByEmail(email string) (*models.User, error) {
+	switch email {
+	case "alice@example.com":
+		return m.Get(1)
+	case "bob@example.com":
+		return m.Get(2)
+	case "carol@example.com":
+		return m.Get(3)
+	case "dave@example.com":
+		return m.Get(5)
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
+
 func (m *UserModel) IsCorrectPassword(id int, password string) error {
 	return nil
 }
@@ -0,0 +1,110 @@
+package mocks
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"thienel/lets-go/internal/models"
+	"time"
+)
+
+// UserSessionModel keeps sessions in memory, so that tests can log in from
+// several clients and log them out of each other.
+type UserSessionModel struct {
+	mu       sync.Mutex
+	nextId   int
+	sessions map[string]*models.UserSession
+}
+
+func (m *UserSessionModel) Insert(userId int, userAgent, ip string, ttl time.Duration) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.sessions == nil {
+		m.sessions = make(map[string]*models.UserSession)
+	}
+	m.nextId++
+
+	key := fmt.Sprintf("session-%d", m.nextId)
+	m.sessions[key] = &models.UserSession{
+		Id:        m.nextId,
+		UserId:    userId,
+		UserAgent: userAgent,
+		IP:        ip,
+		Created:   time.Now(),
+		LastSeen:  time.Now(),
+	}
+
+	return key, nil
+}
+
+func (m *UserSessionModel) Touch(key string, userId int, ip string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[key]
+	if !ok || s.UserId != userId {
+		return false, nil
+	}
+	s.IP = ip
+	s.LastSeen = time.Now()
+
+	return true, nil
+}
+
+func (m *UserSessionModel) GetByUser(userId int, currentKey string) ([]*models.UserSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sessions := []*models.UserSession{}
+	for key, s := range m.sessions {
+		if s.UserId != userId {
+			continue
+		}
+		c := *s
+		c.Current = key == currentKey
+		sessions = append(sessions, &c)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Id > sessions[j].Id
+	})
+
+	return sessions, nil
+}
+
+func (m *UserSessionModel) Delete(id int, userId int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, s := range m.sessions {
+		if s.Id == id && s.UserId == userId {
+			delete(m.sessions, key)
+			return nil
+		}
+	}
+
+	return models.ErrNoRecord
+}
+
+func (m *UserSessionModel) DeleteByKey(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, key)
+	return nil
+}
+
+func (m *UserSessionModel) DeleteOthers(userId int, keepKey string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for key, s := range m.sessions {
+		if s.UserId == userId && key != keepKey {
+			delete(m.sessions, key)
+			n++
+		}
+	}
+
+	return n, nil
+}
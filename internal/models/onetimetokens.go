@@ -0,0 +1,110 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// oneTimeTokens manages the single-use tokens in links emailed to users,
+// such as password reset links, kept in table. The table must have user_id,
+// token_hash and expires columns. As with API tokens, only hashes are
+// stored, and each user has at most one working token per table.
+type oneTimeTokens struct {
+	db    *sql.DB
+	table string
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx.
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// insert creates a token for the user that is valid for ttl and returns its
+// plaintext. Any earlier token for the user stops working, and expired
+// tokens of other users are cleared out on the way.
+func (t oneTimeTokens) insert(userId int, ttl time.Duration) (string, error) {
+	plaintext, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = t.db.Exec(`DELETE FROM `+t.table+`
+	WHERE user_id = ? OR expires <= UTC_TIMESTAMP()`, userId)
+	if err != nil {
+		return "", err
+	}
+
+	stmt := `INSERT INTO ` + t.table + ` (user_id, token_hash, expires)
+	VALUES(?, ?, DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? SECOND))`
+
+	_, err = t.db.Exec(stmt, userId, hashToken(plaintext), int(ttl.Seconds()))
+	if err != nil {
+		return "", err
+	}
+
+	return plaintext, nil
+}
+
+// getUser returns the id of the user an unexpired token was issued to, or
+// ErrInvalidCredentials if there is none. lock is appended to the query,
+// e.g. " FOR UPDATE" within a transaction.
+func (t oneTimeTokens) getUser(q querier, plaintext, lock string) (int, error) {
+	stmt := `SELECT user_id FROM ` + t.table + `
+	WHERE token_hash = ? AND expires > UTC_TIMESTAMP()` + lock
+
+	var userId int
+	err := q.QueryRow(stmt, hashToken(plaintext)).Scan(&userId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrInvalidCredentials
+		}
+		return 0, err
+	}
+
+	return userId, nil
+}
+
+// deleteExpired removes up to limit tokens that expired before the given
+// time, oldest first, and returns how many were removed.
+func (t oneTimeTokens) deleteExpired(before time.Time, limit int) (int, error) {
+	result, err := t.db.Exec(`DELETE FROM `+t.table+` WHERE expires <= ?
+	ORDER BY expires LIMIT ?`, before.UTC(), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// consume uses up a token and returns the id of the user it was issued to.
+// If use isn't nil, it is called with the user's id within the same
+// transaction, so that the token is only used up if use succeeds.
+func (t oneTimeTokens) consume(plaintext string, use func(tx *sql.Tx, userId int) error) (int, error) {
+	tx, err := t.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	userId, err := t.getUser(tx, plaintext, " FOR UPDATE")
+	if err != nil {
+		return 0, err
+	}
+
+	if use != nil {
+		err = use(tx, userId)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = tx.Exec(`DELETE FROM `+t.table+` WHERE user_id = ?`, userId)
+	if err != nil {
+		return 0, err
+	}
+
+	return userId, tx.Commit()
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"testing"
+	"thienel/lets-go/internal/assert"
+	"time"
+)
+
+func TestOneTimeTokensDeleteExpired(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping intergration test")
+	}
+
+	db := newTestDB(t)
+	tokens := oneTimeTokens{db: db, table: "password_resets"}
+
+	live, err := tokens.insert(1, time.Hour)
+	assert.NilErr(t, err)
+
+	// Inserting clears out the user's other tokens, so add the expired ones
+	// by hand.
+	for _, hash := range []string{"expired-1", "expired-2"} {
+		_, err := db.Exec(`INSERT INTO password_resets (user_id, token_hash,
+		expires) VALUES(1, ?, DATE_SUB(UTC_TIMESTAMP(), INTERVAL 1 HOUR))`, hash)
+		assert.NilErr(t, err)
+	}
+
+	n, err := tokens.deleteExpired(time.Now(), 1)
+	assert.NilErr(t, err)
+	assert.Equal(t, n, 1)
+
+	n, err = tokens.deleteExpired(time.Now(), 10)
+	assert.NilErr(t, err)
+	assert.Equal(t, n, 1)
+
+	userId, err := tokens.getUser(db, live, "")
+	assert.NilErr(t, err)
+	assert.Equal(t, userId, 1)
+}
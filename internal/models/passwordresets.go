@@ -0,0 +1,65 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type PasswordResetModelInterface interface {
+	Insert(userId int, ttl time.Duration) (string, error)
+	Get(plaintext string) (int, error)
+	ResetPassword(plaintext, password string) (int, error)
+}
+
+// PasswordResetModel manages the one-time tokens emailed to users who have
+// forgotten their password.
+type PasswordResetModel struct {
+	DB *sql.DB
+}
+
+func (m *PasswordResetModel) tokens() oneTimeTokens {
+	return oneTimeTokens{db: m.DB, table: "password_resets"}
+}
+
+// Insert creates a reset token for the user that is valid for ttl and
+// returns its plaintext.
+func (m *PasswordResetModel) Insert(userId int, ttl time.Duration) (string, error) {
+	return m.tokens().insert(userId, ttl)
+}
+
+// Get returns the id of the user a token was issued to, without using it
+// up. It returns ErrInvalidCredentials if the token is unknown or expired.
+func (m *PasswordResetModel) Get(plaintext string) (int, error) {
+	return m.tokens().getUser(m.DB, plaintext, "")
+}
+
+// ResetPassword sets the password of the user the token was issued to, uses
+// up the token so that the link can't be used again and returns the user's
+// id. Both happen in one transaction, so a failed update leaves the link
+// working. It returns ErrInvalidCredentials if the token is unknown or
+// expired.
+func (m *PasswordResetModel) ResetPassword(plaintext, password string) (int, error) {
+	// The password is hashed first, so that the token's row isn't locked
+	// for the time bcrypt takes.
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return 0, err
+	}
+
+	return m.tokens().consume(plaintext, func(tx *sql.Tx, userId int) error {
+		result, err := tx.Exec(`UPDATE users SET hashed_password = ? WHERE id = ?`,
+			hashedPassword, userId)
+		if err != nil {
+			return err
+		}
+		return requireAffected(result)
+	})
+}
+
+// DeleteExpired removes up to limit tokens that expired before the given
+// time, for the reaper.
+func (m *PasswordResetModel) DeleteExpired(before time.Time, limit int) (int, error) {
+	return m.tokens().deleteExpired(before, limit)
+}
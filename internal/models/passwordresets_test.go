@@ -0,0 +1,47 @@
+package models
+
+import (
+	"testing"
+	"thienel/lets-go/internal/assert"
+	"time"
+)
+
+func TestPasswordResetModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping intergration test")
+	}
+
+	db := newTestDB(t)
+	m := PasswordResetModel{db}
+
+	first, err := m.Insert(1, time.Hour)
+	assert.NilErr(t, err)
+
+	second, err := m.Insert(1, time.Hour)
+	assert.NilErr(t, err)
+
+	// Asking for a new link invalidates the old one.
+	_, err = m.Get(first)
+	assert.Equal(t, err, ErrInvalidCredentials)
+
+	userId, err := m.Get(second)
+	assert.NilErr(t, err)
+	assert.Equal(t, userId, 1)
+
+	userId, err = m.ResetPassword(second, "new pa$$word")
+	assert.NilErr(t, err)
+	assert.Equal(t, userId, 1)
+
+	users := UserModel{db}
+	_, err = users.Authenticate("alice@example.com", "new pa$$word")
+	assert.NilErr(t, err)
+
+	_, err = m.ResetPassword(second, "another pa$$word")
+	assert.Equal(t, err, ErrInvalidCredentials)
+
+	expired, err := m.Insert(1, -time.Minute)
+	assert.NilErr(t, err)
+
+	_, err = m.ResetPassword(expired, "another pa$$word")
+	assert.Equal(t, err, ErrInvalidCredentials)
+}
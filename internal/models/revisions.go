@@ -0,0 +1,84 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type Revision struct {
+	Id        int
+	SnippetId int
+	UserId    int
+	UserName  string
+	Title     string
+	Content   string
+	Created   time.Time
+}
+
+// insertRevision snapshots the current state of a snippet into
+// snippet_revisions as part of tx.
+func insertRevision(tx *sql.Tx, snippetId int) error {
+	stmt := `INSERT INTO snippet_revisions (snippet_id, user_id, title, content, created)
+	SELECT id, user_id, title, content, UTC_TIMESTAMP() FROM snippets WHERE id = ?`
+
+	_, err := tx.Exec(stmt, snippetId)
+	return err
+}
+
+const revisionSelect = `SELECT r.id, r.snippet_id, r.user_id, u.name, r.title,
+	r.content, r.created
+	FROM snippet_revisions r INNER JOIN users u ON u.id = r.user_id`
+
+func scanRevision(row rowScanner) (*Revision, error) {
+	r := &Revision{}
+
+	err := row.Scan(&r.Id, &r.SnippetId, &r.UserId, &r.UserName, &r.Title,
+		&r.Content, &r.Created)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Revisions returns every stored version of a snippet, newest first.
+func (m *SnippetModel) Revisions(snippetId int) ([]*Revision, error) {
+	stmt := revisionSelect + ` WHERE r.snippet_id = ? ORDER BY r.id DESC`
+
+	rows, err := m.DB.Query(stmt, snippetId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*Revision{}
+	for rows.Next() {
+		r, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		revisions = append(revisions, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+func (m *SnippetModel) GetRevision(snippetId int, id int) (*Revision, error) {
+	stmt := revisionSelect + ` WHERE r.snippet_id = ? AND r.id = ?`
+
+	r, err := scanRevision(m.DB.QueryRow(stmt, snippetId, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return r, nil
+}
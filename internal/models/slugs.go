@@ -0,0 +1,22 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+)
+
+// slugBytes is the amount of randomness in a slug. Nine bytes encode to
+// twelve URL-safe characters with no padding.
+const slugBytes = 9
+
+// newSlug returns a random, URL-safe identifier for a snippet. Unlike the
+// AUTO_INCREMENT id it can't be guessed from other snippets' URLs.
+func newSlug() (string, error) {
+	b := make([]byte, slugBytes)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
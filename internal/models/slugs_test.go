@@ -0,0 +1,20 @@
+package models
+
+import (
+	"regexp"
+	"testing"
+	"thienel/lets-go/internal/assert"
+)
+
+func TestNewSlug(t *testing.T) {
+	slugRX := regexp.MustCompile(`^[A-Za-z0-9_-]{12}$`)
+	seen := map[string]bool{}
+
+	for range 100 {
+		slug, err := newSlug()
+		assert.NilErr(t, err)
+		assert.Equal(t, slugRX.MatchString(slug), true)
+		assert.Equal(t, seen[slug], false)
+		seen[slug] = true
+	}
+}
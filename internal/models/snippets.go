@@ -3,54 +3,248 @@ package models
 import (
 	"database/sql"
 	"errors"
+	"slices"
 	"time"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 type SnippetModelInterface interface {
-	Insert(title string, content string, expires int) (int, error)
+	Insert(userId int, title string, content string, language string,
+		visibility string, expires time.Time, burnAfterReading bool,
+		password string, tags []string) (int, string, error)
 	Get(id int) (*Snippet, error)
+	GetBySlug(slug string) (*Snippet, error)
+	Burn(slug string) (*Snippet, error)
+	Unlock(id int, password string) error
+	Update(id int, title string, content string, language string,
+		visibility string, expires time.Time, tags []string) error
 	Lastest() ([]*Snippet, error)
+	Page(after *Cursor, before *Cursor, limit int) (*SnippetPage, error)
+	Search(query string, page int) ([]*Snippet, bool, error)
+	GetByUser(userId int) ([]*Snippet, error)
+	Delete(id int) error
+	Trash(userId int) ([]*Snippet, error)
+	Restore(id int, userId int) error
+	Purge(id int, userId int) error
+	ByTag(name string) ([]*Snippet, error)
+	TagCloud(limit int) ([]*Tag, error)
+	Revisions(snippetId int) ([]*Revision, error)
+	GetRevision(snippetId int, id int) (*Revision, error)
 }
 
+// Snippet visibilities. Public snippets appear in every listing, unlisted
+// ones only to people who have the link and private ones only to their
+// owner.
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPrivate  = "private"
+)
+
+// Snippet is a stored snippet. The API sends snippets as they are and the
+// client decodes them back into a Snippet, so the JSON tags define the API's
+// representation. Listings leave out the content, and unset update and
+// expiry times are left out too.
 type Snippet struct {
-	Id      int
-	Title   string
-	Content string
-	Created time.Time
-	Expires time.Time
+	Id               int       `json:"-"`
+	Slug             string    `json:"slug"`
+	UserId           int       `json:"-"`
+	UserName         string    `json:"author"`
+	Title            string    `json:"title"`
+	Content          string    `json:"content,omitempty"`
+	Language         string    `json:"language"`
+	Visibility       string    `json:"visibility"`
+	BurnAfterReading bool      `json:"burn_after_reading"`
+	Protected        bool      `json:"protected"`
+	Created          time.Time `json:"created"`
+	Updated          time.Time `json:"updated,omitzero"`
+	Expires          time.Time `json:"expires,omitzero"`
+	Deleted          time.Time `json:"-"`
+	Tags             []string  `json:"tags,omitempty"`
+}
+
+// SnippetInput is the body of an API request that creates a snippet. Expires
+// is one of the relative durations offered by the web form (such as "7d"),
+// "never" or "custom", in which case ExpiresAt gives the time.
+type SnippetInput struct {
+	Title            string     `json:"title"`
+	Content          string     `json:"content"`
+	Language         string     `json:"language,omitempty"`
+	Visibility       string     `json:"visibility,omitempty"`
+	Tags             []string   `json:"tags,omitempty"`
+	Expires          string     `json:"expires,omitempty"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	BurnAfterReading bool       `json:"burn_after_reading,omitempty"`
+	Password         string     `json:"password,omitempty"`
 }
 
 type SnippetModel struct {
 	DB *sql.DB
 }
 
-func (m *SnippetModel) Insert(title string, content string,
-	expires int) (int, error) {
-	stmt := `INSERT INTO snippets (title, content, created, expires)
-	VALUES(?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))`
+const snippetSelect = `SELECT s.id, s.slug, s.user_id, u.name, s.title, s.content,
+	s.language, s.visibility, s.burn_after_reading,
+	s.hashed_password IS NOT NULL, s.created, s.updated, s.expires, s.deleted
+	FROM snippets s INNER JOIN users u ON u.id = s.user_id`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSnippet(row rowScanner) (*Snippet, error) {
+	s := &Snippet{}
+	var updated, expires, deleted sql.NullTime
 
-	result, err := m.DB.Exec(stmt, title, content, expires)
+	err := row.Scan(&s.Id, &s.Slug, &s.UserId, &s.UserName, &s.Title, &s.Content,
+		&s.Language, &s.Visibility, &s.BurnAfterReading,
+		&s.Protected, &s.Created, &updated, &expires, &deleted)
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+
+	if updated.Valid {
+		s.Updated = updated.Time
+	}
+	if expires.Valid {
+		s.Expires = expires.Time
+	}
+	if deleted.Valid {
+		s.Deleted = deleted.Time
+	}
+
+	return s, nil
+}
+
+func scanSnippets(rows *sql.Rows) ([]*Snippet, error) {
+	snippets := []*Snippet{}
+	for rows.Next() {
+		s, err := scanSnippet(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		snippets = append(snippets, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// Insert stores a new snippet under a freshly generated slug and returns
+// its id and slug. A zero expires means the snippet never expires.
+func (m *SnippetModel) Insert(userId int, title string, content string,
+	language string, visibility string, expires time.Time,
+	burnAfterReading bool, password string, tags []string) (int, string, error) {
+	slug, err := newSlug()
+	if err != nil {
+		return 0, "", err
+	}
+
+	// An empty password leaves the snippet unprotected.
+	var hashedPassword sql.NullString
+	if password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+		if err != nil {
+			return 0, "", err
+		}
+		hashedPassword = sql.NullString{String: string(hash), Valid: true}
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, "", err
+	}
+	defer tx.Rollback()
+
+	stmt := `INSERT INTO snippets (slug, user_id, title, content, language,
+	visibility, burn_after_reading, hashed_password, created, expires)
+	VALUES(?, ?, ?, ?, ?, ?, ?, ?, UTC_TIMESTAMP(), ?)`
+
+	result, err := tx.Exec(stmt, slug, userId, title, content, language,
+		visibility, burnAfterReading, hashedPassword, nullTime(expires))
+	if err != nil {
+		return 0, "", err
 	}
 
 	id, err := result.LastInsertId()
 	if err != nil {
-		return 0, err
+		return 0, "", err
+	}
+
+	err = setTags(tx, int(id), tags)
+	if err != nil {
+		return 0, "", err
+	}
+
+	err = insertRevision(tx, int(id))
+	if err != nil {
+		return 0, "", err
 	}
 
-	return int(id), nil
+	err = tx.Commit()
+	if err != nil {
+		return 0, "", err
+	}
+
+	return int(id), slug, nil
 }
 
 func (m *SnippetModel) Get(id int) (*Snippet, error) {
-	stmt := `SELECT id, title, content, created, expires FROM snippets
-	WHERE expires > UTC_TIMESTAMP() AND id = ?`
+	return m.getWhere("s.id = ?", id)
+}
 
-	row := m.DB.QueryRow(stmt, id)
+func (m *SnippetModel) GetBySlug(slug string) (*Snippet, error) {
+	return m.getWhere("s.slug = ?", slug)
+}
 
-	s := &Snippet{}
+// Unlock checks password against a protected snippet's password. It
+// returns ErrInvalidCredentials if they don't match and ErrNoRecord if there
+// is no such protected snippet.
+func (m *SnippetModel) Unlock(id int, password string) error {
+	var hashedPassword []byte
+
+	stmt := `SELECT hashed_password FROM snippets
+	WHERE (expires IS NULL OR expires > UTC_TIMESTAMP()) AND deleted IS NULL
+	AND hashed_password IS NOT NULL AND id = ?`
 
-	err := row.Scan(&s.Id, &s.Title, &s.Content, &s.Created, &s.Expires)
+	err := m.DB.QueryRow(stmt, id).Scan(&hashedPassword)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	err = bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrInvalidCredentials
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Burn returns a burn-after-reading snippet and permanently deletes it in
+// the same transaction. The row is locked while it is read, so of two
+// concurrent callers only one gets the snippet; the other gets ErrNoRecord.
+func (m *SnippetModel) Burn(slug string) (*Snippet, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt := snippetSelect + ` WHERE (s.expires IS NULL OR s.expires > UTC_TIMESTAMP())
+	AND s.deleted IS NULL AND s.burn_after_reading AND s.slug = ?
+	FOR UPDATE`
+
+	s, err := scanSnippet(tx.QueryRow(stmt, slug))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNoRecord
@@ -58,12 +252,91 @@ func (m *SnippetModel) Get(id int) (*Snippet, error) {
 			return nil, err
 		}
 	}
+
+	s.Tags, err = tagsFor(tx, s.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM snippets WHERE id = ?`, s.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// getWhere returns the single live snippet matching cond, with its tags.
+func (m *SnippetModel) getWhere(cond string, arg any) (*Snippet, error) {
+	stmt := snippetSelect + ` WHERE (s.expires IS NULL OR s.expires > UTC_TIMESTAMP())
+	AND s.deleted IS NULL AND ` + cond
+
+	s, err := scanSnippet(m.DB.QueryRow(stmt, arg))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		} else {
+			return nil, err
+		}
+	}
+
+	s.Tags, err = tagsFor(m.DB, s.Id)
+	if err != nil {
+		return nil, err
+	}
+
 	return s, nil
 }
 
+// Update replaces the title, content, language, visibility, expiry and tags
+// of a snippet and records the new version in its revision history. It
+// returns ErrNoRecord if the snippet has been deleted or has expired.
+func (m *SnippetModel) Update(id int, title string, content string,
+	language string, visibility string, expires time.Time, tags []string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `UPDATE snippets SET title = ?, content = ?, language = ?, visibility = ?,
+	updated = UTC_TIMESTAMP(), expires = ?
+	WHERE (expires IS NULL OR expires > UTC_TIMESTAMP()) AND deleted IS NULL
+	AND id = ?`
+
+	result, err := tx.Exec(stmt, title, content, language, visibility,
+		nullTime(expires), id)
+	if err != nil {
+		return err
+	}
+
+	err = requireAffected(result)
+	if err != nil {
+		return err
+	}
+
+	err = setTags(tx, id, tags)
+	if err != nil {
+		return err
+	}
+
+	err = insertRevision(tx, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Lastest returns the ten most recent public snippets.
 func (m *SnippetModel) Lastest() ([]*Snippet, error) {
-	stmt := `SELECT id, title, content, created, expires FROM snippets
-	WHERE expires > UTC_TIMESTAMP() ORDER BY id DESC LIMIT 10`
+	stmt := snippetSelect + ` WHERE (s.expires IS NULL OR s.expires > UTC_TIMESTAMP())
+	AND s.deleted IS NULL AND s.visibility = 'public' ORDER BY s.id DESC LIMIT 10`
 
 	rows, err := m.DB.Query(stmt)
 	if err != nil {
@@ -71,21 +344,206 @@ func (m *SnippetModel) Lastest() ([]*Snippet, error) {
 	}
 	defer rows.Close()
 
-	snippets := []*Snippet{}
-	for rows.Next() {
-		s := &Snippet{}
+	return scanSnippets(rows)
+}
 
-		err = rows.Scan(&s.Id, &s.Title, &s.Content, &s.Created, &s.Expires)
-		if err != nil {
-			return nil, err
-		}
+// Page returns up to limit public snippets ordered newest first. With after set
+// the page starts just past that cursor, with before set it ends just
+// before it; with neither it is the first page.
+func (m *SnippetModel) Page(after *Cursor, before *Cursor,
+	limit int) (*SnippetPage, error) {
+	stmt := snippetSelect + ` WHERE (s.expires IS NULL OR s.expires > UTC_TIMESTAMP())
+	AND s.deleted IS NULL AND s.visibility = 'public'`
+	args := []any{}
 
-		snippets = append(snippets, s)
+	switch {
+	case after != nil:
+		stmt += ` AND (s.created < ? OR (s.created = ? AND s.id < ?))
+		ORDER BY s.created DESC, s.id DESC LIMIT ?`
+		args = append(args, after.Created, after.Created, after.Id, limit+1)
+	case before != nil:
+		stmt += ` AND (s.created > ? OR (s.created = ? AND s.id > ?))
+		ORDER BY s.created ASC, s.id ASC LIMIT ?`
+		args = append(args, before.Created, before.Created, before.Id, limit+1)
+	default:
+		stmt += ` ORDER BY s.created DESC, s.id DESC LIMIT ?`
+		args = append(args, limit+1)
 	}
 
-	if err = rows.Err(); err != nil {
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	return snippets, nil
+	snippets, err := scanSnippets(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// One extra row is fetched to find out whether there is another page in
+	// the direction of travel.
+	more := len(snippets) > limit
+	if more {
+		snippets = snippets[:limit]
+	}
+
+	if before != nil {
+		slices.Reverse(snippets)
+	}
+
+	page := &SnippetPage{Snippets: snippets}
+	if len(snippets) == 0 {
+		return page, nil
+	}
+
+	if (before == nil && more) || before != nil {
+		page.Next = NewCursor(snippets[len(snippets)-1])
+	}
+	if (before != nil && more) || after != nil {
+		page.Prev = NewCursor(snippets[0])
+	}
+
+	return page, nil
+}
+
+// SearchPageSize is the number of results returned per page by Search.
+const SearchPageSize = 10
+
+// Search returns the given 1-based page of public snippets whose title or
+// content match query, most relevant first. The boolean reports whether
+// there are further pages. Password-protected snippets are left out so
+// their content can't be probed.
+func (m *SnippetModel) Search(query string, page int) ([]*Snippet, bool, error) {
+	stmt := snippetSelect + ` WHERE (s.expires IS NULL OR s.expires > UTC_TIMESTAMP())
+	AND s.deleted IS NULL AND s.visibility = 'public' AND s.hashed_password IS NULL
+	AND MATCH(s.title, s.content) AGAINST(? IN NATURAL LANGUAGE MODE)
+	ORDER BY MATCH(s.title, s.content) AGAINST(? IN NATURAL LANGUAGE MODE) DESC,
+	s.id DESC LIMIT ? OFFSET ?`
+
+	rows, err := m.DB.Query(stmt, query, query, SearchPageSize+1,
+		(page-1)*SearchPageSize)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	snippets, err := scanSnippets(rows)
+	if err != nil {
+		return nil, false, err
+	}
+
+	more := len(snippets) > SearchPageSize
+	if more {
+		snippets = snippets[:SearchPageSize]
+	}
+
+	return snippets, more, nil
+}
+
+// GetByUser returns all of a user's live snippets, whatever their
+// visibility.
+func (m *SnippetModel) GetByUser(userId int) ([]*Snippet, error) {
+	stmt := snippetSelect + ` WHERE (s.expires IS NULL OR s.expires > UTC_TIMESTAMP())
+	AND s.deleted IS NULL AND s.user_id = ? ORDER BY s.id DESC`
+
+	rows, err := m.DB.Query(stmt, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSnippets(rows)
+}
+
+// Delete moves a snippet into its owner's trash. The row is kept so it can
+// be restored until it is purged.
+func (m *SnippetModel) Delete(id int) error {
+	stmt := `UPDATE snippets SET deleted = UTC_TIMESTAMP()
+	WHERE deleted IS NULL AND id = ?`
+
+	result, err := m.DB.Exec(stmt, id)
+	if err != nil {
+		return err
+	}
+
+	return requireAffected(result)
+}
+
+func (m *SnippetModel) Trash(userId int) ([]*Snippet, error) {
+	stmt := snippetSelect + ` WHERE s.deleted IS NOT NULL AND s.user_id = ?
+	ORDER BY s.deleted DESC`
+
+	rows, err := m.DB.Query(stmt, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSnippets(rows)
+}
+
+func (m *SnippetModel) Restore(id int, userId int) error {
+	stmt := `UPDATE snippets SET deleted = NULL
+	WHERE deleted IS NOT NULL AND id = ? AND user_id = ?`
+
+	result, err := m.DB.Exec(stmt, id, userId)
+	if err != nil {
+		return err
+	}
+
+	return requireAffected(result)
+}
+
+// Purge permanently removes a snippet. Only snippets that are already in
+// the owner's trash can be purged.
+func (m *SnippetModel) Purge(id int, userId int) error {
+	stmt := `DELETE FROM snippets
+	WHERE deleted IS NOT NULL AND id = ? AND user_id = ?`
+
+	result, err := m.DB.Exec(stmt, id, userId)
+	if err != nil {
+		return err
+	}
+
+	return requireAffected(result)
+}
+
+// DeleteExpired permanently removes up to limit snippets that expired
+// before the given time, oldest first, and returns how many were removed.
+// Their revisions and tag links go with them.
+func (m *SnippetModel) DeleteExpired(before time.Time, limit int) (int, error) {
+	stmt := `DELETE FROM snippets WHERE expires IS NOT NULL AND expires <= ?
+	ORDER BY expires LIMIT ?`
+
+	result, err := m.DB.Exec(stmt, before.UTC(), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
+}
+
+// nullTime stores the zero time as NULL, which for expires means the
+// snippet never expires.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t.UTC(), Valid: !t.IsZero()}
+}
+
+func requireAffected(result sql.Result) error {
+	affectedRows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affectedRows == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
 }
@@ -0,0 +1,415 @@
+package models
+
+import (
+	"testing"
+	"thienel/lets-go/internal/assert"
+	"time"
+)
+
+var nextWeek = time.Now().Add(7 * 24 * time.Hour)
+
+func TestSnippetModelGetByUser(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping intergration test")
+	}
+
+	tests := []struct {
+		name      string
+		userId    int
+		wantCount int
+	}{
+		{
+			name:      "Owner",
+			userId:    1,
+			wantCount: 1,
+		},
+		{
+			name:      "Non-existent user",
+			userId:    2,
+			wantCount: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			m := SnippetModel{db}
+
+			snippets, err := m.GetByUser(tt.userId)
+
+			assert.NilErr(t, err)
+			assert.Equal(t, len(snippets), tt.wantCount)
+		})
+	}
+}
+
+func TestSnippetModelInsert(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping intergration test")
+	}
+
+	db := newTestDB(t)
+	m := SnippetModel{db}
+
+	id, slug, err := m.Insert(1, "Title", "Content", "", VisibilityPublic, nextWeek, false, "", nil)
+	assert.NilErr(t, err)
+	assert.Equal(t, len(slug), 12)
+
+	s, err := m.Get(id)
+	assert.NilErr(t, err)
+	assert.Equal(t, s.Slug, slug)
+	assert.Equal(t, s.UserId, 1)
+	assert.Equal(t, s.UserName, "Alice Jones")
+
+	s, err = m.GetBySlug(slug)
+	assert.NilErr(t, err)
+	assert.Equal(t, s.Id, id)
+
+	_, err = m.GetBySlug("b2xkLXBvbmQy")
+	assert.Equal(t, err, ErrNoRecord)
+}
+
+func TestSnippetModelUpdate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping intergration test")
+	}
+
+	db := newTestDB(t)
+	m := SnippetModel{db}
+
+	err := m.Update(1, "New title", "New content", "go", VisibilityPublic, nextWeek, nil)
+	assert.NilErr(t, err)
+
+	s, err := m.Get(1)
+	assert.NilErr(t, err)
+	assert.Equal(t, s.Title, "New title")
+	assert.Equal(t, s.Content, "New content")
+	assert.Equal(t, s.Language, "go")
+	assert.Equal(t, s.Updated.IsZero(), false)
+
+	err = m.Update(99, "New title", "New content", "go", VisibilityPublic, nextWeek, nil)
+	assert.Equal(t, err, ErrNoRecord)
+
+	err = m.Delete(1)
+	assert.NilErr(t, err)
+	err = m.Update(1, "Newer title", "New content", "go", VisibilityPublic, nextWeek, nil)
+	assert.Equal(t, err, ErrNoRecord)
+}
+
+func TestSnippetModelTrash(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping intergration test")
+	}
+
+	db := newTestDB(t)
+	m := SnippetModel{db}
+
+	err := m.Delete(1)
+	assert.NilErr(t, err)
+
+	_, err = m.Get(1)
+	assert.Equal(t, err, ErrNoRecord)
+
+	trash, err := m.Trash(1)
+	assert.NilErr(t, err)
+	assert.Equal(t, len(trash), 1)
+
+	err = m.Restore(1, 1)
+	assert.NilErr(t, err)
+
+	_, err = m.Get(1)
+	assert.NilErr(t, err)
+
+	err = m.Purge(1, 1)
+	assert.Equal(t, err, ErrNoRecord)
+
+	assert.NilErr(t, m.Delete(1))
+	assert.NilErr(t, m.Purge(1, 1))
+
+	trash, err = m.Trash(1)
+	assert.NilErr(t, err)
+	assert.Equal(t, len(trash), 0)
+}
+
+func TestSnippetModelRevisions(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping intergration test")
+	}
+
+	db := newTestDB(t)
+	m := SnippetModel{db}
+
+	err := m.Update(1, "New title", "New content", "", VisibilityPublic, nextWeek, nil)
+	assert.NilErr(t, err)
+
+	revisions, err := m.Revisions(1)
+	assert.NilErr(t, err)
+	assert.Equal(t, len(revisions), 2)
+	assert.Equal(t, revisions[0].Title, "New title")
+	assert.Equal(t, revisions[0].UserName, "Alice Jones")
+	assert.Equal(t, revisions[1].Content, "An old silent pond...")
+
+	r, err := m.GetRevision(1, revisions[1].Id)
+	assert.NilErr(t, err)
+	assert.Equal(t, r.Content, "An old silent pond...")
+
+	_, err = m.GetRevision(2, revisions[1].Id)
+	assert.Equal(t, err, ErrNoRecord)
+}
+
+func TestSnippetModelPage(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping intergration test")
+	}
+
+	db := newTestDB(t)
+	m := SnippetModel{db}
+
+	for range 4 {
+		_, _, err := m.Insert(1, "Title", "Content", "", VisibilityPublic, nextWeek, false, "", nil)
+		assert.NilErr(t, err)
+	}
+
+	first, err := m.Page(nil, nil, 2)
+	assert.NilErr(t, err)
+	assert.Equal(t, len(first.Snippets), 2)
+	assert.Equal(t, first.Prev == nil, true)
+	assert.Equal(t, first.Next != nil, true)
+
+	second, err := m.Page(first.Next, nil, 2)
+	assert.NilErr(t, err)
+	assert.Equal(t, len(second.Snippets), 2)
+	assert.Equal(t, second.Prev != nil, true)
+
+	last, err := m.Page(second.Next, nil, 2)
+	assert.NilErr(t, err)
+	assert.Equal(t, len(last.Snippets), 1)
+	assert.Equal(t, last.Next == nil, true)
+
+	back, err := m.Page(nil, second.Prev, 2)
+	assert.NilErr(t, err)
+	assert.Equal(t, back.Snippets[0].Id, first.Snippets[0].Id)
+	assert.Equal(t, back.Prev == nil, true)
+}
+
+func TestSnippetModelSearch(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping intergration test")
+	}
+
+	db := newTestDB(t)
+	m := SnippetModel{db}
+
+	_, _, err := m.Insert(1, "Email regex", "A regex that matches email addresses",
+		"", VisibilityPublic, nextWeek, false, "", []string{"regex"})
+	assert.NilErr(t, err)
+
+	snippets, more, err := m.Search("regex", 1)
+	assert.NilErr(t, err)
+	assert.Equal(t, len(snippets), 1)
+	assert.Equal(t, snippets[0].Title, "Email regex")
+	assert.Equal(t, more, false)
+
+	snippets, _, err = m.Search("regex", 2)
+	assert.NilErr(t, err)
+	assert.Equal(t, len(snippets), 0)
+}
+
+func TestSnippetModelTags(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping intergration test")
+	}
+
+	db := newTestDB(t)
+	m := SnippetModel{db}
+
+	id, _, err := m.Insert(1, "Title", "Content", "", VisibilityPublic, nextWeek, false, "", []string{"poetry", "go"})
+	assert.NilErr(t, err)
+
+	s, err := m.Get(id)
+	assert.NilErr(t, err)
+	assert.Equal(t, len(s.Tags), 2)
+	assert.Equal(t, s.Tags[0], "go")
+
+	snippets, err := m.ByTag("poetry")
+	assert.NilErr(t, err)
+	assert.Equal(t, len(snippets), 2)
+
+	cloud, err := m.TagCloud(10)
+	assert.NilErr(t, err)
+	assert.Equal(t, cloud[0].Name, "poetry")
+	assert.Equal(t, cloud[0].Count, 2)
+
+	err = m.Update(id, "Title", "Content", "", VisibilityPublic, nextWeek, []string{"go"})
+	assert.NilErr(t, err)
+
+	snippets, err = m.ByTag("poetry")
+	assert.NilErr(t, err)
+	assert.Equal(t, len(snippets), 1)
+}
+
+func TestSnippetModelVisibility(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping intergration test")
+	}
+
+	db := newTestDB(t)
+	m := SnippetModel{db}
+
+	unlisted, _, err := m.Insert(1, "Unlisted haiku", "A quiet haiku", "",
+		VisibilityUnlisted, nextWeek, false, "", []string{"poetry"})
+	assert.NilErr(t, err)
+
+	private, _, err := m.Insert(1, "Private haiku", "A secret haiku", "",
+		VisibilityPrivate, nextWeek, false, "", []string{"poetry"})
+	assert.NilErr(t, err)
+
+	latest, err := m.Lastest()
+	assert.NilErr(t, err)
+	assert.Equal(t, len(latest), 1)
+
+	results, _, err := m.Search("haiku", 1)
+	assert.NilErr(t, err)
+	assert.Equal(t, len(results), 0)
+
+	tagged, err := m.ByTag("poetry")
+	assert.NilErr(t, err)
+	assert.Equal(t, len(tagged), 1)
+
+	own, err := m.GetByUser(1)
+	assert.NilErr(t, err)
+	assert.Equal(t, len(own), 3)
+
+	s, err := m.Get(unlisted)
+	assert.NilErr(t, err)
+	assert.Equal(t, s.Visibility, VisibilityUnlisted)
+
+	s, err = m.Get(private)
+	assert.NilErr(t, err)
+	assert.Equal(t, s.Visibility, VisibilityPrivate)
+}
+
+func TestSnippetModelBurn(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping intergration test")
+	}
+
+	db := newTestDB(t)
+	m := SnippetModel{db}
+
+	_, err := m.Burn("b2xkLXBvbmQx")
+	assert.Equal(t, err, ErrNoRecord)
+
+	id, slug, err := m.Insert(1, "Secret", "hunter2", "", VisibilityUnlisted, nextWeek,
+		true, "", nil)
+	assert.NilErr(t, err)
+
+	s, err := m.GetBySlug(slug)
+	assert.NilErr(t, err)
+	assert.Equal(t, s.BurnAfterReading, true)
+
+	s, err = m.Burn(slug)
+	assert.NilErr(t, err)
+	assert.Equal(t, s.Id, id)
+	assert.Equal(t, s.Content, "hunter2")
+
+	_, err = m.Burn(slug)
+	assert.Equal(t, err, ErrNoRecord)
+
+	_, err = m.Get(id)
+	assert.Equal(t, err, ErrNoRecord)
+}
+
+func TestSnippetModelUnlock(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping intergration test")
+	}
+
+	db := newTestDB(t)
+	m := SnippetModel{db}
+
+	err := m.Unlock(1, "")
+	assert.Equal(t, err, ErrNoRecord)
+
+	id, _, err := m.Insert(1, "Protected", "Protected content", "",
+		VisibilityPublic, nextWeek, false, "open sesame", nil)
+	assert.NilErr(t, err)
+
+	s, err := m.Get(id)
+	assert.NilErr(t, err)
+	assert.Equal(t, s.Protected, true)
+
+	err = m.Unlock(id, "wrong")
+	assert.Equal(t, err, ErrInvalidCredentials)
+
+	err = m.Unlock(id, "open sesame")
+	assert.NilErr(t, err)
+
+	snippets, _, err := m.Search("protected", 1)
+	assert.NilErr(t, err)
+	assert.Equal(t, len(snippets), 0)
+}
+
+func TestSnippetModelExpiry(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping intergration test")
+	}
+
+	db := newTestDB(t)
+	m := SnippetModel{db}
+
+	id, _, err := m.Insert(1, "Forever", "Content", "", VisibilityPublic,
+		time.Time{}, false, "", nil)
+	assert.NilErr(t, err)
+
+	s, err := m.Get(id)
+	assert.NilErr(t, err)
+	assert.Equal(t, s.Expires.IsZero(), true)
+
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	err = m.Update(id, "Soon", "Content", "", VisibilityPublic, expires, nil)
+	assert.NilErr(t, err)
+
+	s, err = m.Get(id)
+	assert.NilErr(t, err)
+	assert.Equal(t, s.Expires.Equal(expires), true)
+
+	err = m.Update(id, "Gone", "Content", "", VisibilityPublic,
+		time.Now().Add(-time.Hour), nil)
+	assert.NilErr(t, err)
+
+	_, err = m.Get(id)
+	assert.Equal(t, err, ErrNoRecord)
+}
+
+func TestSnippetModelDeleteExpired(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping intergration test")
+	}
+
+	db := newTestDB(t)
+	m := SnippetModel{db}
+
+	for range 3 {
+		_, _, err := m.Insert(1, "Expiring", "Content", "", VisibilityPublic,
+			time.Now().Add(time.Minute), false, "", []string{"poetry"})
+		assert.NilErr(t, err)
+	}
+
+	later := time.Now().Add(time.Hour)
+
+	n, err := m.DeleteExpired(later, 2)
+	assert.NilErr(t, err)
+	assert.Equal(t, n, 2)
+
+	n, err = m.DeleteExpired(later, 2)
+	assert.NilErr(t, err)
+	assert.Equal(t, n, 1)
+
+	n, err = m.DeleteExpired(later, 2)
+	assert.NilErr(t, err)
+	assert.Equal(t, n, 0)
+
+	_, err = m.Get(1)
+	assert.NilErr(t, err)
+}
@@ -0,0 +1,120 @@
+package models
+
+import "database/sql"
+
+type Tag struct {
+	Name  string
+	Count int
+}
+
+// setTags replaces the tags attached to a snippet as part of tx, creating
+// any tags that don't exist yet.
+func setTags(tx *sql.Tx, snippetId int, tags []string) error {
+	_, err := tx.Exec("DELETE FROM snippet_tags WHERE snippet_id = ?", snippetId)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range tags {
+		// LAST_INSERT_ID(id) makes LastInsertId report the existing row when
+		// the tag is already known.
+		result, err := tx.Exec(`INSERT INTO tags (name) VALUES (?)
+		ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id)`, name)
+		if err != nil {
+			return err
+		}
+
+		tagId, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`INSERT IGNORE INTO snippet_tags (snippet_id, tag_id)
+		VALUES (?, ?)`, snippetId, tagId)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// tagsFor returns the names of the tags attached to a snippet, read through
+// q so that it can be part of a transaction.
+func tagsFor(q querier, snippetId int) ([]string, error) {
+	stmt := `SELECT t.name FROM tags t
+	INNER JOIN snippet_tags st ON st.tag_id = t.id
+	WHERE st.snippet_id = ? ORDER BY t.name`
+
+	rows, err := q.Query(stmt, snippetId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []string{}
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tags = append(tags, name)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// ByTag returns the live public snippets carrying the named tag, newest
+// first.
+func (m *SnippetModel) ByTag(name string) ([]*Snippet, error) {
+	stmt := snippetSelect + `
+	INNER JOIN snippet_tags st ON st.snippet_id = s.id
+	INNER JOIN tags t ON t.id = st.tag_id
+	WHERE (s.expires IS NULL OR s.expires > UTC_TIMESTAMP()) AND s.deleted IS NULL
+	AND s.visibility = 'public' AND t.name = ?
+	ORDER BY s.created DESC, s.id DESC`
+
+	rows, err := m.DB.Query(stmt, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSnippets(rows)
+}
+
+// TagCloud returns up to limit of the tags used by live public snippets,
+// most used first.
+func (m *SnippetModel) TagCloud(limit int) ([]*Tag, error) {
+	stmt := `SELECT t.name, COUNT(*) FROM tags t
+	INNER JOIN snippet_tags st ON st.tag_id = t.id
+	INNER JOIN snippets s ON s.id = st.snippet_id
+	WHERE (s.expires IS NULL OR s.expires > UTC_TIMESTAMP()) AND s.deleted IS NULL
+	AND s.visibility = 'public'
+	GROUP BY t.id, t.name ORDER BY COUNT(*) DESC, t.name LIMIT ?`
+
+	rows, err := m.DB.Query(stmt, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*Tag{}
+	for rows.Next() {
+		t := &Tag{}
+		if err = rows.Scan(&t.Name, &t.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
@@ -1,15 +1,189 @@
+DROP TABLE IF EXISTS user_sessions;
+DROP TABLE IF EXISTS audit_log;
+DROP TABLE IF EXISTS login_attempts;
+DROP TABLE IF EXISTS account_unlocks;
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS email_verifications;
+DROP TABLE IF EXISTS password_resets;
+DROP TABLE IF EXISTS api_tokens;
+DROP TABLE IF EXISTS snippet_tags;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS snippet_revisions;
 DROP TABLE IF EXISTS snippets;
 DROP TABLE IF EXISTS users;
 
+CREATE TABLE users (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    name VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    hashed_password CHAR(60) NOT NULL,
+    email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+    totp_secret VARCHAR(64),
+    totp_last_step BIGINT NOT NULL DEFAULT 0,
+    created DATETIME NOT NULL
+);
+
+ALTER TABLE users ADD CONSTRAINT users_uc_email UNIQUE (email);
+
 CREATE TABLE snippets (
     id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    slug CHAR(12) NOT NULL,
+    user_id INTEGER NOT NULL,
     title VARCHAR(100) NOT NULL,
     content TEXT NOT NULL,
+    language VARCHAR(32) NOT NULL DEFAULT '',
+    visibility ENUM('public', 'unlisted', 'private') NOT NULL DEFAULT 'public',
+    burn_after_reading BOOLEAN NOT NULL DEFAULT FALSE,
+    hashed_password CHAR(60),
     created DATETIME NOT NULL,
-    expires DATETIME NOT NULL
+    updated DATETIME,
+    expires DATETIME,
+    deleted DATETIME,
+    CONSTRAINT snippets_fk_user FOREIGN KEY (user_id) REFERENCES users(id)
 );
 
+ALTER TABLE snippets ADD CONSTRAINT snippets_uc_slug UNIQUE (slug);
+
 CREATE INDEX idx_snippets_created ON snippets(created);
+CREATE INDEX idx_snippets_expires ON snippets(expires);
+CREATE FULLTEXT INDEX idx_snippets_fulltext ON snippets(title, content);
+
+CREATE TABLE snippet_revisions (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    snippet_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    title VARCHAR(100) NOT NULL,
+    content TEXT NOT NULL,
+    created DATETIME NOT NULL,
+    CONSTRAINT snippet_revisions_fk_snippet FOREIGN KEY (snippet_id)
+        REFERENCES snippets(id) ON DELETE CASCADE,
+    CONSTRAINT snippet_revisions_fk_user FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE tags (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    name VARCHAR(20) NOT NULL
+);
+
+ALTER TABLE tags ADD CONSTRAINT tags_uc_name UNIQUE (name);
+
+CREATE TABLE snippet_tags (
+    snippet_id INTEGER NOT NULL,
+    tag_id INTEGER NOT NULL,
+    PRIMARY KEY (snippet_id, tag_id),
+    CONSTRAINT snippet_tags_fk_snippet FOREIGN KEY (snippet_id)
+        REFERENCES snippets(id) ON DELETE CASCADE,
+    CONSTRAINT snippet_tags_fk_tag FOREIGN KEY (tag_id)
+        REFERENCES tags(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_snippet_tags_tag ON snippet_tags(tag_id);
+
+CREATE TABLE api_tokens (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    token_hash CHAR(64) NOT NULL,
+    scopes SET('read', 'write') NOT NULL,
+    created DATETIME NOT NULL,
+    last_used DATETIME,
+    CONSTRAINT api_tokens_fk_user FOREIGN KEY (user_id)
+        REFERENCES users(id) ON DELETE CASCADE
+);
+
+ALTER TABLE api_tokens ADD CONSTRAINT api_tokens_uc_token_hash UNIQUE (token_hash);
+
+CREATE TABLE password_resets (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    token_hash CHAR(64) NOT NULL,
+    expires DATETIME NOT NULL,
+    CONSTRAINT password_resets_fk_user FOREIGN KEY (user_id)
+        REFERENCES users(id) ON DELETE CASCADE
+);
+
+ALTER TABLE password_resets ADD CONSTRAINT password_resets_uc_token_hash
+    UNIQUE (token_hash);
+
+CREATE INDEX idx_password_resets_expires ON password_resets(expires);
+
+CREATE TABLE email_verifications (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    token_hash CHAR(64) NOT NULL,
+    expires DATETIME NOT NULL,
+    CONSTRAINT email_verifications_fk_user FOREIGN KEY (user_id)
+        REFERENCES users(id) ON DELETE CASCADE
+);
+
+ALTER TABLE email_verifications ADD CONSTRAINT email_verifications_uc_token_hash
+    UNIQUE (token_hash);
+
+CREATE INDEX idx_email_verifications_expires ON email_verifications(expires);
+
+CREATE TABLE recovery_codes (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    code_hash CHAR(64) NOT NULL,
+    CONSTRAINT recovery_codes_fk_user FOREIGN KEY (user_id)
+        REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_recovery_codes_user ON recovery_codes(user_id, code_hash);
+
+CREATE TABLE account_unlocks (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    token_hash CHAR(64) NOT NULL,
+    expires DATETIME NOT NULL,
+    CONSTRAINT account_unlocks_fk_user FOREIGN KEY (user_id)
+        REFERENCES users(id) ON DELETE CASCADE
+);
+
+ALTER TABLE account_unlocks ADD CONSTRAINT account_unlocks_uc_token_hash
+    UNIQUE (token_hash);
+
+CREATE INDEX idx_account_unlocks_expires ON account_unlocks(expires);
+
+CREATE TABLE login_attempts (
+    attempt_key VARCHAR(255) NOT NULL PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    last_failure DATETIME NOT NULL,
+    locked_until DATETIME
+);
+
+CREATE INDEX idx_login_attempts_last_failure ON login_attempts(last_failure);
+
+CREATE TABLE audit_log (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER,
+    event VARCHAR(50) NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    detail VARCHAR(255) NOT NULL,
+    created DATETIME NOT NULL,
+    CONSTRAINT audit_log_fk_user FOREIGN KEY (user_id)
+        REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_audit_log_created ON audit_log(created);
+
+CREATE TABLE user_sessions (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    key_hash CHAR(64) NOT NULL,
+    user_agent VARCHAR(255) NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    created DATETIME NOT NULL,
+    last_seen DATETIME NOT NULL,
+    expires DATETIME NOT NULL,
+    CONSTRAINT user_sessions_fk_user FOREIGN KEY (user_id)
+        REFERENCES users(id) ON DELETE CASCADE
+);
+
+ALTER TABLE user_sessions ADD CONSTRAINT user_sessions_uc_key_hash
+    UNIQUE (key_hash);
+
+CREATE INDEX idx_user_sessions_expires ON user_sessions(expires);
 
 CREATE TABLE sessions (
     token CHAR(43) PRIMARY KEY,
@@ -19,19 +193,25 @@ CREATE TABLE sessions (
 
 CREATE INDEX sessions_expiry_idx ON sessions (expiry);
 
-CREATE TABLE users (
-    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
-    name VARCHAR(255) NOT NULL,
-    email VARCHAR(255) NOT NULL,
-    hashed_password CHAR(60) NOT NULL,
-    created DATETIME NOT NULL
-);
-
-ALTER TABLE users ADD CONSTRAINT users_uc_email UNIQUE (email);
-
-INSERT INTO users (name, email, hashed_password, created) VALUES (
+INSERT INTO users (name, email, hashed_password, email_verified, created) VALUES (
     'Alice Jones',
     'alice@example.com',
     '$2a$12$NuTjWXm3KKntReFwyBVHyuf/to.HEwTy.eS206TNfkGfr6HzGJSWG',
+    TRUE,
     '2022-01-01 10:00:00'
 );
+
+INSERT INTO snippets (slug, user_id, title, content, created, expires) VALUES (
+    'b2xkLXBvbmQx',
+    1,
+    'An old silent pond',
+    'An old silent pond...',
+    UTC_TIMESTAMP(),
+    DATE_ADD(UTC_TIMESTAMP(), INTERVAL 365 DAY)
+);
+
+INSERT INTO snippet_revisions (snippet_id, user_id, title, content, created)
+SELECT id, user_id, title, content, created FROM snippets WHERE id = 1;
+
+INSERT INTO tags (name) VALUES ('poetry');
+INSERT INTO snippet_tags (snippet_id, tag_id) VALUES (1, 1);
@@ -1,2 +1,14 @@
-DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS user_sessions;
+DROP TABLE IF EXISTS audit_log;
+DROP TABLE IF EXISTS login_attempts;
+DROP TABLE IF EXISTS account_unlocks;
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS email_verifications;
+DROP TABLE IF EXISTS password_resets;
+DROP TABLE IF EXISTS api_tokens;
+DROP TABLE IF EXISTS snippet_tags;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS snippet_revisions;
 DROP TABLE IF EXISTS snippets;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS sessions;
@@ -0,0 +1,175 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Token scopes. Read allows fetching snippets through the API and write
+// allows creating them.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// tokenPrefix marks personal access tokens so they are easy to recognise,
+// e.g. by secret scanners.
+const tokenPrefix = "sb_"
+
+type TokenModelInterface interface {
+	Insert(userId int, name string, scopes []string) (string, error)
+	GetByUser(userId int) ([]*Token, error)
+	Delete(id int, userId int) error
+	Authenticate(plaintext string) (*Token, error)
+}
+
+// Token is a personal access token. Only a hash of the token itself is
+// stored; the plaintext is shown to the user once, when it is created.
+type Token struct {
+	Id       int
+	UserId   int
+	Name     string
+	Scopes   []string
+	Created  time.Time
+	LastUsed time.Time
+}
+
+func (t *Token) HasScope(scope string) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+type TokenModel struct {
+	DB *sql.DB
+}
+
+func hashToken(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomToken returns 32 random bytes, base64url encoded. Only hashes of
+// these are stored, so they must be unguessable rather than unique.
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Insert creates a token for the user and returns its plaintext.
+func (m *TokenModel) Insert(userId int, name string, scopes []string) (string, error) {
+	random, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	plaintext := tokenPrefix + random
+
+	stmt := `INSERT INTO api_tokens (user_id, name, token_hash, scopes, created)
+	VALUES(?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	_, err = m.DB.Exec(stmt, userId, name, hashToken(plaintext),
+		strings.Join(scopes, ","))
+	if err != nil {
+		return "", err
+	}
+
+	return plaintext, nil
+}
+
+const tokenSelect = `SELECT id, user_id, name, scopes, created, last_used
+	FROM api_tokens`
+
+func scanToken(row rowScanner) (*Token, error) {
+	t := &Token{}
+	var scopes string
+	var lastUsed sql.NullTime
+
+	err := row.Scan(&t.Id, &t.UserId, &t.Name, &scopes, &t.Created, &lastUsed)
+	if err != nil {
+		return nil, err
+	}
+
+	if scopes != "" {
+		t.Scopes = strings.Split(scopes, ",")
+	}
+	if lastUsed.Valid {
+		t.LastUsed = lastUsed.Time
+	}
+
+	return t, nil
+}
+
+func (m *TokenModel) GetByUser(userId int) ([]*Token, error) {
+	stmt := tokenSelect + ` WHERE user_id = ? ORDER BY id DESC`
+
+	rows, err := m.DB.Query(stmt, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*Token{}
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// Delete revokes one of the user's tokens.
+func (m *TokenModel) Delete(id int, userId int) error {
+	stmt := `DELETE FROM api_tokens WHERE id = ? AND user_id = ?`
+
+	result, err := m.DB.Exec(stmt, id, userId)
+	if err != nil {
+		return err
+	}
+
+	return requireAffected(result)
+}
+
+// Authenticate looks up the token with the given plaintext and records that
+// it has been used. It returns ErrInvalidCredentials if there is none.
+func (m *TokenModel) Authenticate(plaintext string) (*Token, error) {
+	if !strings.HasPrefix(plaintext, tokenPrefix) {
+		return nil, ErrInvalidCredentials
+	}
+
+	hash := hashToken(plaintext)
+
+	stmt := tokenSelect + ` WHERE token_hash = ?`
+
+	t, err := scanToken(m.DB.QueryRow(stmt, hash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	_, err = m.DB.Exec(`UPDATE api_tokens SET last_used = UTC_TIMESTAMP()
+	WHERE id = ?`, t.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
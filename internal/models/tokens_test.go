@@ -0,0 +1,43 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"thienel/lets-go/internal/assert"
+)
+
+func TestTokenModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping intergration test")
+	}
+
+	db := newTestDB(t)
+	m := TokenModel{db}
+
+	plaintext, err := m.Insert(1, "CI", []string{ScopeRead, ScopeWrite})
+	assert.NilErr(t, err)
+	assert.Equal(t, strings.HasPrefix(plaintext, "sb_"), true)
+
+	token, err := m.Authenticate(plaintext)
+	assert.NilErr(t, err)
+	assert.Equal(t, token.UserId, 1)
+	assert.Equal(t, token.Name, "CI")
+	assert.Equal(t, token.HasScope(ScopeWrite), true)
+
+	_, err = m.Authenticate(plaintext + "x")
+	assert.Equal(t, err, ErrInvalidCredentials)
+
+	tokens, err := m.GetByUser(1)
+	assert.NilErr(t, err)
+	assert.Equal(t, len(tokens), 1)
+	assert.Equal(t, tokens[0].LastUsed.IsZero(), false)
+
+	err = m.Delete(token.Id, 2)
+	assert.Equal(t, err, ErrNoRecord)
+
+	err = m.Delete(token.Id, 1)
+	assert.NilErr(t, err)
+
+	_, err = m.Authenticate(plaintext)
+	assert.Equal(t, err, ErrInvalidCredentials)
+}
@@ -0,0 +1,183 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+)
+
+// recoveryCodeCount is how many recovery codes a user gets when they turn on
+// two-factor authentication.
+const recoveryCodeCount = 10
+
+type TwoFactorModelInterface interface {
+	Enable(userId int, secret string, step int64) ([]string, error)
+	Disable(userId int) error
+	Secret(userId int) (string, error)
+	UseStep(userId int, step int64) error
+	UseRecoveryCode(userId int, code string) error
+	RecoveryCodesLeft(userId int) (int, error)
+}
+
+// TwoFactorModel stores users' TOTP secrets and their single-use recovery
+// codes. As with API tokens, only hashes of the recovery codes are stored.
+type TwoFactorModel struct {
+	DB *sql.DB
+}
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newRecoveryCode returns a random code of 10 base32 characters, such as
+// "7qhe2-xkm4d".
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 7)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	code := strings.ToLower(recoveryEncoding.EncodeToString(b)[:10])
+	return code[:5] + "-" + code[5:], nil
+}
+
+// normalizeRecoveryCode lets users type recovery codes in either case and
+// with or without the dash.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// Enable turns on two-factor authentication for the user with the given
+// base32 TOTP secret. step is the time step of the code the user confirmed
+// the secret with, which is marked as used in the same transaction so that
+// the code can't also be used to log in. It returns a fresh set of recovery
+// codes, which replace any the user had before.
+func (m *TwoFactorModel) Enable(userId int, secret string, step int64) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE users SET totp_secret = ?, totp_last_step = ?
+	WHERE id = ?`, secret, step, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	err = requireAffected(result)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, code := range codes {
+		_, err = tx.Exec(`INSERT INTO recovery_codes (user_id, code_hash)
+		VALUES(?, ?)`, userId, hashToken(normalizeRecoveryCode(code)))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return codes, tx.Commit()
+}
+
+// Disable turns off two-factor authentication for the user and deletes
+// their recovery codes.
+func (m *TwoFactorModel) Disable(userId int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE users SET totp_secret = NULL WHERE id = ?`, userId)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userId)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Secret returns the user's TOTP secret, or ErrNoRecord if they haven't
+// turned on two-factor authentication.
+func (m *TwoFactorModel) Secret(userId int) (string, error) {
+	var secret sql.NullString
+
+	err := m.DB.QueryRow(`SELECT totp_secret FROM users WHERE id = ?`,
+		userId).Scan(&secret)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrNoRecord
+		}
+		return "", err
+	}
+
+	if !secret.Valid {
+		return "", ErrNoRecord
+	}
+
+	return secret.String, nil
+}
+
+// UseStep records that the user has logged in with the code for the given
+// TOTP time step. It returns ErrInvalidCredentials if that step, or a later
+// one, has been used already, so that an observed code can't be replayed.
+func (m *TwoFactorModel) UseStep(userId int, step int64) error {
+	result, err := m.DB.Exec(`UPDATE users SET totp_last_step = ?
+	WHERE id = ? AND totp_last_step < ?`, step, userId, step)
+	if err != nil {
+		return err
+	}
+
+	err = requireAffected(result)
+	if errors.Is(err, ErrNoRecord) {
+		return ErrInvalidCredentials
+	}
+	return err
+}
+
+// UseRecoveryCode uses up one of the user's recovery codes. It returns
+// ErrInvalidCredentials if the code isn't one of theirs or has been used.
+func (m *TwoFactorModel) UseRecoveryCode(userId int, code string) error {
+	result, err := m.DB.Exec(`DELETE FROM recovery_codes
+	WHERE user_id = ? AND code_hash = ?`, userId,
+		hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+
+	err = requireAffected(result)
+	if errors.Is(err, ErrNoRecord) {
+		return ErrInvalidCredentials
+	}
+	return err
+}
+
+func (m *TwoFactorModel) RecoveryCodesLeft(userId int) (int, error) {
+	var n int
+
+	err := m.DB.QueryRow(`SELECT COUNT(*) FROM recovery_codes WHERE user_id = ?`,
+		userId).Scan(&n)
+	return n, err
+}
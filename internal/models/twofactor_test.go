@@ -0,0 +1,65 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"thienel/lets-go/internal/assert"
+)
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	code, err := newRecoveryCode()
+	assert.NilErr(t, err)
+	assert.Equal(t, len(code), 11)
+
+	assert.Equal(t, normalizeRecoveryCode(code), strings.Replace(code, "-", "", 1))
+	assert.Equal(t, normalizeRecoveryCode(" ABCDE-fghij"), "abcdefghij")
+}
+
+func TestTwoFactorModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping intergration test")
+	}
+
+	db := newTestDB(t)
+	users := UserModel{db}
+	m := TwoFactorModel{db}
+
+	_, err := m.Secret(1)
+	assert.Equal(t, err, ErrNoRecord)
+
+	codes, err := m.Enable(1, "JBSWY3DPEHPK3PXP", 99)
+	assert.NilErr(t, err)
+	assert.Equal(t, len(codes), recoveryCodeCount)
+
+	user, err := users.Get(1)
+	assert.NilErr(t, err)
+	assert.Equal(t, user.TwoFactorEnabled, true)
+
+	secret, err := m.Secret(1)
+	assert.NilErr(t, err)
+	assert.Equal(t, secret, "JBSWY3DPEHPK3PXP")
+
+	// The step the secret was confirmed with is already used.
+	assert.Equal(t, m.UseStep(1, 99), ErrInvalidCredentials)
+	assert.NilErr(t, m.UseStep(1, 100))
+	assert.Equal(t, m.UseStep(1, 100), ErrInvalidCredentials)
+	assert.Equal(t, m.UseStep(1, 99), ErrInvalidCredentials)
+	assert.NilErr(t, m.UseStep(1, 101))
+
+	assert.NilErr(t, m.UseRecoveryCode(1, strings.ToUpper(codes[0])))
+	assert.Equal(t, m.UseRecoveryCode(1, codes[0]), ErrInvalidCredentials)
+	assert.Equal(t, m.UseRecoveryCode(1, "aaaaa-aaaaa"), ErrInvalidCredentials)
+
+	left, err := m.RecoveryCodesLeft(1)
+	assert.NilErr(t, err)
+	assert.Equal(t, left, recoveryCodeCount-1)
+
+	assert.NilErr(t, m.Disable(1))
+
+	_, err = m.Secret(1)
+	assert.Equal(t, err, ErrNoRecord)
+
+	left, err = m.RecoveryCodesLeft(1)
+	assert.NilErr(t, err)
+	assert.Equal(t, left, 0)
+}
@@ -11,10 +11,11 @@ import (
 )
 
 type UserModelInterface interface {
-	Insert(name, email, password string) error
+	Insert(name, email, password string) (int, error)
 	Authenticate(email, password string) (int, error)
 	Exists(id int) (bool, error)
 	Get(id int) (*User, error)
+	GetByEmail(email string) (*User, error)
 	IsCorrectPassword(id int, password string) error
 	ChangePassword(id int, password string) error
 }
@@ -24,35 +25,45 @@ type User struct {
 	Name           string
 	Email          string
 	HashedPassword []byte
-	Created        time.Time
+	EmailVerified  bool
+	// TwoFactorEnabled is set once the user has confirmed a TOTP secret.
+	TwoFactorEnabled bool
+	Created          time.Time
 }
 
 type UserModel struct {
 	DB *sql.DB
 }
 
-func (m *UserModel) Insert(name, email, password string) error {
+// Insert creates a user, whose email address starts out unverified, and
+// returns its id.
+func (m *UserModel) Insert(name, email, password string) (int, error) {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	stmt := `INSERT INTO users (name, email, hashed_password, created)
 		VALUES(?, ?, ?, UTC_TIMESTAMP())`
 
-	_, err = m.DB.Exec(stmt, name, email, string(hashedPassword))
+	result, err := m.DB.Exec(stmt, name, email, string(hashedPassword))
 	if err != nil {
 		var mySQLError *mysql.MySQLError
 		if errors.As(err, &mySQLError) {
 			if mySQLError.Number == 1062 && strings.Contains(
 				mySQLError.Message, "users_uc_email") {
-				return ErrDuplicateEmail
+				return 0, ErrDuplicateEmail
 			}
 		}
-		return err
+		return 0, err
 	}
 
-	return nil
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
 }
 
 func (m *UserModel) Authenticate(email, password string) (int, error) {
@@ -140,15 +151,27 @@ func (m *UserModel) Exists(id int) (bool, error) {
 }
 
 func (m *UserModel) Get(id int) (*User, error) {
+	return m.getWhere("id = ?", id)
+}
+
+func (m *UserModel) GetByEmail(email string) (*User, error) {
+	return m.getWhere("email = ?", email)
+}
+
+func (m *UserModel) getWhere(cond string, arg any) (*User, error) {
 	var user User
 
-	stmt := "SELECT * FROM users WHERE id = ? LIMIT 1"
+	stmt := `SELECT id, name, email, hashed_password, email_verified,
+	totp_secret IS NOT NULL, created
+	FROM users WHERE ` + cond + ` LIMIT 1`
 
-	err := m.DB.QueryRow(stmt, id).Scan(
+	err := m.DB.QueryRow(stmt, arg).Scan(
 		&user.Id,
 		&user.Name,
 		&user.Email,
 		&user.HashedPassword,
+		&user.EmailVerified,
+		&user.TwoFactorEnabled,
 		&user.Created,
 	)
 
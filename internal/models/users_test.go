@@ -42,3 +42,20 @@ func TestUserModelExists(t *testing.T) {
 		})
 	}
 }
+
+func TestUserModelGetByEmail(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping intergration test")
+	}
+
+	db := newTestDB(t)
+	m := UserModel{db}
+
+	user, err := m.GetByEmail("alice@example.com")
+	assert.NilErr(t, err)
+	assert.Equal(t, user.Id, 1)
+	assert.Equal(t, user.Name, "Alice Jones")
+
+	_, err = m.GetByEmail("nobody@example.com")
+	assert.Equal(t, err, ErrNoRecord)
+}
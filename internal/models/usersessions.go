@@ -0,0 +1,182 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// touchInterval is how often a session's last-seen time and address are
+// updated, so that not every request has to write to the database.
+const touchInterval = time.Minute
+
+type UserSessionModelInterface interface {
+	Insert(userId int, userAgent, ip string, ttl time.Duration) (string, error)
+	Touch(key string, userId int, ip string) (bool, error)
+	GetByUser(userId int, currentKey string) ([]*UserSession, error)
+	Delete(id int, userId int) error
+	DeleteByKey(key string) error
+	DeleteOthers(userId int, keepKey string) (int, error)
+}
+
+// UserSession is a logged-in browser session. Each is identified by a random
+// key kept in the session data, of which only a hash is stored here, so that
+// sessions can be listed and revoked by their user.
+type UserSession struct {
+	Id        int
+	UserId    int
+	UserAgent string
+	IP        string
+	Created   time.Time
+	LastSeen  time.Time
+	// Current is set for the session the list was asked for from.
+	Current bool
+}
+
+type UserSessionModel struct {
+	DB *sql.DB
+}
+
+// Insert records a new session for the user that lasts for ttl, and returns
+// its key. Expired sessions of the user are cleared out on the way.
+func (m *UserSessionModel) Insert(userId int, userAgent, ip string, ttl time.Duration) (string, error) {
+	key, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = m.DB.Exec(`DELETE FROM user_sessions
+	WHERE user_id = ? AND expires <= UTC_TIMESTAMP()`, userId)
+	if err != nil {
+		return "", err
+	}
+
+	if ua := []rune(userAgent); len(ua) > 255 {
+		userAgent = string(ua[:255])
+	}
+
+	stmt := `INSERT INTO user_sessions (user_id, key_hash, user_agent, ip,
+	created, last_seen, expires)
+	VALUES(?, ?, ?, ?, UTC_TIMESTAMP(), UTC_TIMESTAMP(),
+	DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? SECOND))`
+
+	_, err = m.DB.Exec(stmt, userId, hashToken(key), userAgent, ip,
+		int(ttl.Seconds()))
+	if err != nil {
+		return "", err
+	}
+
+	return key, nil
+}
+
+// Touch reports whether the session with key is still active for the user,
+// and if so records that it has just been seen from ip. The record is only
+// written once every touchInterval.
+func (m *UserSessionModel) Touch(key string, userId int, ip string) (bool, error) {
+	var id int
+	var lastSeen time.Time
+
+	stmt := `SELECT id, last_seen FROM user_sessions
+	WHERE key_hash = ? AND user_id = ? AND expires > UTC_TIMESTAMP()`
+
+	err := m.DB.QueryRow(stmt, hashToken(key), userId).Scan(&id, &lastSeen)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if time.Since(lastSeen) >= touchInterval {
+		_, err = m.DB.Exec(`UPDATE user_sessions SET ip = ?,
+		last_seen = UTC_TIMESTAMP() WHERE id = ?`, ip, id)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// GetByUser returns the user's active sessions, most recently seen first,
+// marking the one with currentKey as current.
+func (m *UserSessionModel) GetByUser(userId int, currentKey string) ([]*UserSession, error) {
+	stmt := `SELECT id, user_id, key_hash, user_agent, ip, created, last_seen
+	FROM user_sessions WHERE user_id = ? AND expires > UTC_TIMESTAMP()
+	ORDER BY last_seen DESC, id DESC`
+
+	rows, err := m.DB.Query(stmt, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	currentHash := hashToken(currentKey)
+
+	sessions := []*UserSession{}
+	for rows.Next() {
+		s := &UserSession{}
+		var keyHash string
+
+		err := rows.Scan(&s.Id, &s.UserId, &keyHash, &s.UserAgent, &s.IP,
+			&s.Created, &s.LastSeen)
+		if err != nil {
+			return nil, err
+		}
+		s.Current = currentKey != "" && keyHash == currentHash
+
+		sessions = append(sessions, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// Delete logs out one of the user's sessions.
+func (m *UserSessionModel) Delete(id int, userId int) error {
+	result, err := m.DB.Exec(`DELETE FROM user_sessions WHERE id = ? AND user_id = ?`,
+		id, userId)
+	if err != nil {
+		return err
+	}
+
+	return requireAffected(result)
+}
+
+// DeleteByKey logs out the session with key, if it is still active.
+func (m *UserSessionModel) DeleteByKey(key string) error {
+	_, err := m.DB.Exec(`DELETE FROM user_sessions WHERE key_hash = ?`,
+		hashToken(key))
+	return err
+}
+
+// DeleteExpired removes up to limit sessions that expired before the given
+// time, oldest first, for the reaper.
+func (m *UserSessionModel) DeleteExpired(before time.Time, limit int) (int, error) {
+	result, err := m.DB.Exec(`DELETE FROM user_sessions WHERE expires <= ?
+	ORDER BY expires LIMIT ?`, before.UTC(), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// DeleteOthers logs out all the user's sessions except the one with
+// keepKey, or all of them if keepKey is empty, and returns how many active
+// sessions were logged out.
+func (m *UserSessionModel) DeleteOthers(userId int, keepKey string) (int, error) {
+	result, err := m.DB.Exec(`DELETE FROM user_sessions
+	WHERE user_id = ? AND key_hash <> ? AND expires > UTC_TIMESTAMP()`,
+		userId, hashToken(keepKey))
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"testing"
+	"thienel/lets-go/internal/assert"
+	"time"
+)
+
+func TestUserSessionModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping intergration test")
+	}
+
+	db := newTestDB(t)
+	m := UserSessionModel{db}
+
+	first, err := m.Insert(1, "Firefox", "192.0.2.1", time.Hour)
+	assert.NilErr(t, err)
+
+	second, err := m.Insert(1, "Safari", "192.0.2.2", time.Hour)
+	assert.NilErr(t, err)
+
+	expired, err := m.Insert(1, "Chrome", "192.0.2.3", -time.Minute)
+	assert.NilErr(t, err)
+
+	ok, err := m.Touch(first, 1, "192.0.2.9")
+	assert.NilErr(t, err)
+	assert.Equal(t, ok, true)
+
+	ok, err = m.Touch(first, 2, "192.0.2.9")
+	assert.NilErr(t, err)
+	assert.Equal(t, ok, false)
+
+	ok, err = m.Touch(expired, 1, "192.0.2.3")
+	assert.NilErr(t, err)
+	assert.Equal(t, ok, false)
+
+	sessions, err := m.GetByUser(1, first)
+	assert.NilErr(t, err)
+	assert.Equal(t, len(sessions), 2)
+
+	var current *UserSession
+	for _, s := range sessions {
+		if s.Current {
+			current = s
+		}
+	}
+	if current == nil {
+		t.Fatal("no session is marked as current")
+	}
+	assert.Equal(t, current.UserAgent, "Firefox")
+	// The session was only just created, so touching it doesn't write.
+	assert.Equal(t, current.IP, "192.0.2.1")
+
+	err = m.Delete(current.Id, 2)
+	assert.Equal(t, err, ErrNoRecord)
+
+	n, err := m.DeleteOthers(1, first)
+	assert.NilErr(t, err)
+	assert.Equal(t, n, 1)
+
+	ok, err = m.Touch(second, 1, "192.0.2.2")
+	assert.NilErr(t, err)
+	assert.Equal(t, ok, false)
+
+	err = m.Delete(current.Id, 1)
+	assert.NilErr(t, err)
+
+	ok, err = m.Touch(first, 1, "192.0.2.9")
+	assert.NilErr(t, err)
+	assert.Equal(t, ok, false)
+
+	third, err := m.Insert(1, "Edge", "192.0.2.4", time.Hour)
+	assert.NilErr(t, err)
+
+	err = m.DeleteByKey(third)
+	assert.NilErr(t, err)
+
+	sessions, err = m.GetByUser(1, "")
+	assert.NilErr(t, err)
+	assert.Equal(t, len(sessions), 0)
+}
+
+func TestUserSessionModelDeleteExpired(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping intergration test")
+	}
+
+	db := newTestDB(t)
+	m := UserSessionModel{db}
+
+	_, err := m.Insert(1, "Firefox", "192.0.2.1", -time.Minute)
+	assert.NilErr(t, err)
+	live, err := m.Insert(1, "Safari", "192.0.2.2", time.Hour)
+	assert.NilErr(t, err)
+
+	n, err := m.DeleteExpired(time.Now(), 10)
+	assert.NilErr(t, err)
+	assert.Equal(t, n, 1)
+
+	ok, err := m.Touch(live, 1, "192.0.2.2")
+	assert.NilErr(t, err)
+	assert.Equal(t, ok, true)
+}
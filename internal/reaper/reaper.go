@@ -0,0 +1,152 @@
+// Package reaper periodically deletes expired rows, such as snippets and
+// one-time tokens. Lookups already ignore them, but without the reaper they
+// would stay in the database forever.
+package reaper
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"sync"
+	"time"
+)
+
+// Store deletes up to limit rows that expired before the given time and
+// reports how many it deleted. *models.SnippetModel, among others,
+// satisfies it.
+type Store interface {
+	DeleteExpired(before time.Time, limit int) (int, error)
+}
+
+// Clock abstracts time so tests can drive the reaper by hand.
+type Clock interface {
+	Now() time.Time
+	// NewTicker returns a channel that delivers a tick every d, and a
+	// function that stops it.
+	NewTicker(d time.Duration) (<-chan time.Time, func())
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTicker(d time.Duration) (<-chan time.Time, func()) {
+	t := time.NewTicker(d)
+	return t.C, t.Stop
+}
+
+// Stats are running totals of the reaper's work.
+type Stats struct {
+	Sweeps  int64
+	Purged  int64
+	Errors  int64
+	LastRun time.Time
+}
+
+type Reaper struct {
+	name      string
+	store     Store
+	interval  time.Duration
+	batchSize int
+	clock     Clock
+	infoLog   *log.Logger
+	errorLog  *log.Logger
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+// New returns a reaper that sweeps store every interval, deleting at most
+// batchSize rows per statement so that a large backlog doesn't hold long
+// locks. name says what the rows are in logs, e.g. "snippets".
+func New(name string, store Store, interval time.Duration, batchSize int,
+	infoLog *log.Logger, errorLog *log.Logger) *Reaper {
+	return &Reaper{
+		name:      name,
+		store:     store,
+		interval:  interval,
+		batchSize: batchSize,
+		clock:     realClock{},
+		infoLog:   infoLog,
+		errorLog:  errorLog,
+	}
+}
+
+// Run sweeps once straight away and then on every tick until ctx is
+// cancelled.
+func (r *Reaper) Run(ctx context.Context) {
+	tick, stop := r.clock.NewTicker(r.interval)
+	defer stop()
+
+	for {
+		n, err := r.Sweep(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.errorLog.Printf("reaper: %s: %v", r.name, err)
+		} else if n > 0 {
+			r.infoLog.Printf("reaper: purged %d expired %s", n, r.name)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+		}
+	}
+}
+
+// Sweep deletes everything that has expired, one batch at a time, and
+// returns the number of rows deleted. It stops early if ctx is cancelled.
+func (r *Reaper) Sweep(ctx context.Context) (int, error) {
+	now := r.clock.Now()
+	total := 0
+
+	var err error
+	for ctx.Err() == nil {
+		var n int
+		n, err = r.store.DeleteExpired(now, r.batchSize)
+		total += n
+		if err != nil || n < r.batchSize {
+			break
+		}
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+
+	r.mu.Lock()
+	r.stats.Sweeps++
+	r.stats.Purged += int64(total)
+	if err != nil {
+		r.stats.Errors++
+	}
+	r.stats.LastRun = now
+	r.mu.Unlock()
+
+	return total, err
+}
+
+func (r *Reaper) Name() string {
+	return r.name
+}
+
+func (r *Reaper) Stats() Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.stats
+}
+
+// Publish exposes the stats of reapers as the expvar "reaper", keyed by
+// name, so that they can be watched while the application runs. It must
+// only be called once.
+func Publish(reapers ...*Reaper) {
+	expvar.Publish("reaper", expvar.Func(func() any {
+		stats := make(map[string]Stats, len(reapers))
+		for _, r := range reapers {
+			stats[r.name] = r.Stats()
+		}
+		return stats
+	}))
+}
@@ -0,0 +1,173 @@
+package reaper
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"io"
+	"log"
+	"sync"
+	"testing"
+	"thienel/lets-go/internal/assert"
+	"time"
+)
+
+type fakeClock struct {
+	mu   sync.Mutex
+	now  time.Time
+	tick chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{
+		now:  time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+		tick: make(chan time.Time),
+	}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) (<-chan time.Time, func()) {
+	return c.tick, func() {}
+}
+
+// fakeStore holds the expiry times of its rows.
+type fakeStore struct {
+	mu      sync.Mutex
+	expires []time.Time
+	calls   []time.Time
+	err     error
+}
+
+func (s *fakeStore) DeleteExpired(before time.Time, limit int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls = append(s.calls, before)
+	if s.err != nil {
+		return 0, s.err
+	}
+
+	kept := []time.Time{}
+	n := 0
+	for _, e := range s.expires {
+		if n < limit && !e.After(before) {
+			n++
+			continue
+		}
+		kept = append(kept, e)
+	}
+	s.expires = kept
+
+	return n, nil
+}
+
+func (s *fakeStore) remaining() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.expires)
+}
+
+func newTestReaper(store Store, clock Clock) *Reaper {
+	r := New("snippets", store, time.Minute, 2, log.New(io.Discard, "", 0),
+		log.New(io.Discard, "", 0))
+	r.clock = clock
+	return r
+}
+
+func TestSweep(t *testing.T) {
+	clock := newFakeClock()
+	store := &fakeStore{}
+	for i := range 5 {
+		store.expires = append(store.expires, clock.now.Add(-time.Duration(i)*time.Hour))
+	}
+	store.expires = append(store.expires, clock.now.Add(time.Hour))
+
+	r := newTestReaper(store, clock)
+
+	n, err := r.Sweep(context.Background())
+	assert.NilErr(t, err)
+	assert.Equal(t, n, 5)
+	assert.Equal(t, store.remaining(), 1)
+
+	// Batches of two: 2, 2, 1.
+	assert.Equal(t, len(store.calls), 3)
+
+	stats := r.Stats()
+	assert.Equal(t, stats.Sweeps, int64(1))
+	assert.Equal(t, stats.Purged, int64(5))
+	assert.Equal(t, stats.LastRun, clock.now)
+}
+
+func TestSweepError(t *testing.T) {
+	store := &fakeStore{err: errors.New("database is down")}
+	r := newTestReaper(store, newFakeClock())
+
+	_, err := r.Sweep(context.Background())
+	assert.Equal(t, err, store.err)
+	assert.Equal(t, r.Stats().Errors, int64(1))
+}
+
+func TestRun(t *testing.T) {
+	clock := newFakeClock()
+	store := &fakeStore{expires: []time.Time{clock.now.Add(30 * time.Minute)}}
+	r := newTestReaper(store, clock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Run(ctx)
+		close(done)
+	}()
+
+	// The first sweep runs straight away; nothing has expired yet. The
+	// ticker channel is unbuffered, so each send below completes only once
+	// the sweep before it has finished.
+	clock.tick <- time.Time{}
+	assert.Equal(t, store.remaining(), 1)
+
+	clock.advance(time.Hour)
+	clock.tick <- time.Time{}
+	clock.tick <- time.Time{}
+	assert.Equal(t, store.remaining(), 0)
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after its context was cancelled")
+	}
+
+	assert.Equal(t, r.Stats().Purged, int64(1))
+}
+
+func TestPublish(t *testing.T) {
+	clock := newFakeClock()
+	store := &fakeStore{expires: []time.Time{clock.now.Add(-time.Hour)}}
+	r := newTestReaper(store, clock)
+
+	Publish(r)
+
+	_, err := r.Sweep(context.Background())
+	assert.NilErr(t, err)
+
+	v := expvar.Get("reaper")
+	if v == nil {
+		t.Fatal("reaper stats are not published")
+	}
+	assert.StringContains(t, v.String(), `"snippets":{"Sweeps":1,"Purged":1,`)
+}
@@ -0,0 +1,159 @@
+package syntax
+
+import (
+	"html/template"
+	"path"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// Auto is the language value meaning "detect the language from the content".
+const Auto = ""
+
+type Language struct {
+	Name      string
+	Label     string
+	Extension string
+}
+
+// Languages lists the languages offered when creating a snippet. Name is
+// the chroma lexer alias stored against the snippet.
+var Languages = []Language{
+	{"bash", "Bash", ".sh"},
+	{"c", "C", ".c"},
+	{"csharp", "C#", ".cs"},
+	{"cpp", "C++", ".cpp"},
+	{"css", "CSS", ".css"},
+	{"go", "Go", ".go"},
+	{"html", "HTML", ".html"},
+	{"java", "Java", ".java"},
+	{"javascript", "JavaScript", ".js"},
+	{"json", "JSON", ".json"},
+	{"markdown", "Markdown", ".md"},
+	{"php", "PHP", ".php"},
+	{"plaintext", "Plain text", ".txt"},
+	{"python", "Python", ".py"},
+	{"ruby", "Ruby", ".rb"},
+	{"rust", "Rust", ".rs"},
+	{"sql", "SQL", ".sql"},
+	{"typescript", "TypeScript", ".ts"},
+	{"yaml", "YAML", ".yaml"},
+}
+
+// Names returns the permitted language values, including Auto.
+func Names() []string {
+	names := []string{Auto}
+	for _, l := range Languages {
+		names = append(names, l.Name)
+	}
+	return names
+}
+
+// Label returns the display name of a language, or "" if it is unknown.
+func Label(name string) string {
+	for _, l := range Languages {
+		if l.Name == name {
+			return l.Label
+		}
+	}
+	return ""
+}
+
+// otherExtensions maps common file extensions that aren't the canonical
+// Extension of a language to that language.
+var otherExtensions = map[string]string{
+	".bash":     "bash",
+	".h":        "c",
+	".cc":       "cpp",
+	".cxx":      "cpp",
+	".hpp":      "cpp",
+	".htm":      "html",
+	".mjs":      "javascript",
+	".jsx":      "javascript",
+	".markdown": "markdown",
+	".text":     "plaintext",
+	".log":      "plaintext",
+	".tsx":      "typescript",
+	".yml":      "yaml",
+}
+
+// ForFilename returns the language of a file going by its extension, or
+// Auto if the extension isn't one of the listed languages'.
+func ForFilename(filename string) string {
+	ext := strings.ToLower(path.Ext(filename))
+	if ext == "" {
+		return Auto
+	}
+
+	for _, l := range Languages {
+		if l.Extension == ext {
+			return l.Name
+		}
+	}
+
+	if name, ok := otherExtensions[ext]; ok {
+		return name
+	}
+
+	return Auto
+}
+
+// style is the chroma style ui/static/css/chroma.css was generated from.
+var style = styles.Get("github")
+
+// Extension returns the file extension, including the dot, used for
+// downloads of a snippet in the given language. Unknown languages and Auto
+// get ".txt".
+func Extension(name string) string {
+	for _, l := range Languages {
+		if l.Name == name {
+			return l.Extension
+		}
+	}
+	return ".txt"
+}
+
+// formatter emits CSS classes rather than inline styles so the output is
+// allowed by the Content-Security-Policy; the matching rules live in
+// ui/static/css/chroma.css.
+var formatter = html.New(
+	html.WithClasses(true),
+	html.PreventSurroundingPre(true),
+	html.TabWidth(4),
+)
+
+func lexerFor(content, language string) chroma.Lexer {
+	var lexer chroma.Lexer
+	if language != Auto {
+		lexer = lexers.Get(language)
+	} else {
+		lexer = lexers.Analyse(content)
+	}
+
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+
+	return chroma.Coalesce(lexer)
+}
+
+// HTML renders content as highlighted HTML suitable for placing inside a
+// <pre><code> element.
+func HTML(content, language string) (template.HTML, error) {
+	iterator, err := lexerFor(content, language).Tokenise(nil, content)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	err = formatter.Format(&b, style, iterator)
+	if err != nil {
+		return "", err
+	}
+
+	return template.HTML(b.String()), nil
+}
@@ -0,0 +1,80 @@
+package syntax
+
+import (
+	"strings"
+	"testing"
+	"thienel/lets-go/internal/assert"
+
+	"github.com/alecthomas/chroma/v2/lexers"
+)
+
+func TestLanguagesHaveLexers(t *testing.T) {
+	for _, l := range Languages {
+		t.Run(l.Label, func(t *testing.T) {
+			if lexers.Get(l.Name) == nil {
+				t.Errorf("no lexer for %q", l.Name)
+			}
+		})
+	}
+}
+
+func TestForFilename(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{"main.go", "go"},
+		{"Makefile", Auto},
+		{"config.YML", "yaml"},
+		{"header.h", "c"},
+		{"archive.tar.gz", Auto},
+		{"notes.txt", "plaintext"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			assert.Equal(t, ForFilename(tt.filename), tt.want)
+		})
+	}
+}
+
+func TestHTML(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		language  string
+		wantClass string
+	}{
+		{
+			name:      "Go keyword",
+			content:   "package main",
+			language:  "go",
+			wantClass: `<span class="kn">package</span>`,
+		},
+		{
+			name:      "Escapes markup",
+			content:   "<script>alert(1)</script>",
+			language:  "plaintext",
+			wantClass: "&lt;script&gt;",
+		},
+		{
+			name:      "Auto-detect",
+			content:   "#!/bin/bash\necho hello",
+			language:  Auto,
+			wantClass: `<span class="nb">echo</span>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html, err := HTML(tt.content, tt.language)
+
+			assert.NilErr(t, err)
+			assert.StringContains(t, string(html), tt.wantClass)
+
+			if strings.Contains(string(html), "<pre") {
+				t.Errorf("got: %q; expected no surrounding <pre>", html)
+			}
+		})
+	}
+}
@@ -12,6 +12,8 @@ var EmailRX = regexp.MustCompile(
 		"(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$",
 )
 
+var TagRX = regexp.MustCompile("^[a-z0-9][a-z0-9+#._-]*$")
+
 type Validator struct {
 	NonFieldErrors []string
 	FieldErrors    map[string]string
@@ -55,6 +57,20 @@ func PermittedValue[T comparable](value T, permittedValues ...T) bool {
 	return false
 }
 
+func MaxItems[T any](values []T, n int) bool {
+	return len(values) <= n
+}
+
+func AllValid[T any](values []T, check func(T) bool) bool {
+	for _, value := range values {
+		if !check(value) {
+			return false
+		}
+	}
+
+	return true
+}
+
 func Minchars(value string, n int) bool {
 	return utf8.RuneCountInString(value) >= n
 }